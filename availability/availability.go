@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// Package availability publishes whether a daemon is running to a retained MQTT topic.
+//
+// It uses its own MQTT connection, whose Last Will marks the daemon offline if it dies without saying goodbye.
+package availability
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type (
+	// Publisher keeps an availability topic up to date.
+	Publisher struct {
+		client mqtt.Client
+		topic  string
+	}
+
+	// Options configure how a Publisher connects to the broker.
+	Options struct {
+		Username string
+		Password string
+		// ClientID is the main connection's client ID; if set, the Publisher uses it with an "-availability" suffix.
+		ClientID  string
+		KeepAlive time.Duration
+		TLSConfig *tls.Config
+	}
+)
+
+// Availability payloads.
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+const (
+	qos     = 1
+	timeout = 5 * time.Second
+)
+
+// NewPublisher returns a Publisher for the given topic.
+// The name identifies the daemon to the broker.
+func NewPublisher(brokerURI, topic, name string) *Publisher {
+	return NewPublisherWithOptions(brokerURI, topic, name, Options{})
+}
+
+// NewPublisherWithOptions returns a Publisher for the given topic, with the given connection options.
+// The name identifies the daemon to the broker.
+func NewPublisherWithOptions(brokerURI, topic, name string, o Options) *Publisher {
+	p := &Publisher{topic: topic}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(brokerURI)
+	if o.ClientID != "" {
+		opts.SetClientID(o.ClientID + "-availability")
+	} else {
+		hostname, _ := os.Hostname()
+		opts.SetClientID(fmt.Sprintf("%s-availability-%s-%d", name, hostname, os.Getpid()))
+	}
+	if o.Username != "" {
+		opts.SetUsername(o.Username)
+		opts.SetPassword(o.Password)
+	}
+	if o.KeepAlive > 0 {
+		opts.SetKeepAlive(o.KeepAlive)
+	}
+	if o.TLSConfig != nil {
+		opts.SetTLSConfig(o.TLSConfig)
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetWill(topic, Offline, qos, true)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		if err := p.publish(client, Online); err != nil {
+			log.Printf("could not publish availability to %v: %v", topic, err)
+		}
+	})
+
+	p.client = mqtt.NewClient(opts)
+	return p
+}
+
+// Connect connects to the broker, and marks the daemon online whenever it is connected.
+// If the broker can't be reached, it returns an error, but keeps retrying in the background.
+func (p *Publisher) Connect() error {
+	token := p.client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("not connected to MQTT broker after %v, retrying", timeout)
+	}
+	return token.Error()
+}
+
+// Close marks the daemon offline, and disconnects from the broker.
+func (p *Publisher) Close() error {
+	err := p.publish(p.client, Offline)
+	p.client.Disconnect(uint(timeout / time.Millisecond))
+	return err
+}
+
+func (p *Publisher) publish(client mqtt.Client, payload string) error {
+	token := client.Publish(p.topic, qos, true, payload)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("timed out publishing %q", payload)
+	}
+	return token.Error()
+}
@@ -0,0 +1,341 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"go.eth.moe/catbus-snapcast/metrics"
+	"go.eth.moe/catbus-snapcast/scenes"
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+// subscribe subscribes to the topics the Bridge takes commands from in actuate mode, and the presence topics in follow-me mode.
+// It is called whenever either connection is (re)established, when the groups change, and when the config is reloaded.
+// It unsubscribes from topics that are no longer in use.
+func (b *Bridge) subscribe() {
+	// commands are only handled when sent live, while states are also handled when retained.
+	commands := map[string]func(string){}
+	states := map[string]func(string){}
+	if b.opts.Mode&Actuate != 0 {
+		b.commandHandlers(commands)
+	}
+	if b.opts.Mode&FollowMe != 0 {
+		b.presenceHandlers(states)
+	}
+
+	b.mu.Lock()
+	broker := b.broker
+	old := b.subscriptions
+	b.subscriptions = map[string]bool{}
+	for topic := range commands {
+		b.subscriptions[topic] = true
+	}
+	for topic := range states {
+		b.subscriptions[topic] = true
+	}
+	subscriptions := b.subscriptions
+	b.mu.Unlock()
+
+	for topic := range old {
+		if subscriptions[topic] {
+			continue
+		}
+		if err := broker.Unsubscribe(topic); err != nil {
+			log.Printf("could not unsubscribe from %v: %v", topic, err)
+		}
+	}
+
+	if b.opts.Mode&Actuate != 0 {
+		// Replace any stale retained time remaining.
+		for _, group := range b.controlledGroups() {
+			b.publishSleepTimerRemaining(group.ID)
+		}
+	}
+
+	for topic, handler := range commands {
+		topic, handler := topic, handler
+		if err := broker.Subscribe(topic, func(msg message) {
+			if b.isSubscribed(topic) && b.isCommand(topic, msg) {
+				handler(msg.Payload)
+			}
+		}); err != nil {
+			log.Printf("could not subscribe to %v: %v", topic, err)
+		}
+	}
+	for topic, handler := range states {
+		topic, handler := topic, handler
+		if err := broker.Subscribe(topic, func(msg message) {
+			if b.isSubscribed(topic) {
+				handler(msg.Payload)
+			}
+		}); err != nil {
+			log.Printf("could not subscribe to %v: %v", topic, err)
+		}
+	}
+}
+
+// commandHandlers adds handlers for the scene topic, and for each group the Bridge controls,
+// its input, volume, and sleep timer topics, and the volume and mute topics of each of its speakers.
+// Topics can depend on the groups, so there are none for groups until the groups are known.
+func (b *Bridge) commandHandlers(handlers map[string]func(string)) {
+	cfg := b.cfg()
+	if cfg.Topics.Scene != "" {
+		handlers[cfg.Topics.Scene] = b.restoreScene
+	}
+
+	for _, group := range b.controlledGroups() {
+		groupID := group.ID
+		handlers[cfg.InputTopic(group)] = func(payload string) {
+			b.setInput(groupID, payload)
+		}
+		handlers[cfg.GroupVolumeTopic(group)] = func(payload string) {
+			b.setGroupVolume(groupID, payload)
+		}
+		handlers[cfg.SleepTimerTopic(group)] = func(payload string) {
+			b.setSleepTimer(groupID, payload)
+		}
+		for _, speaker := range group.Speakers {
+			speakerID := speaker.ID
+			handlers[cfg.SpeakerVolumeTopic(group, speaker)] = func(payload string) {
+				b.setSpeakerVolume(groupID, speakerID, payload)
+			}
+			handlers[cfg.SpeakerMuteTopic(group, speaker)] = func(payload string) {
+				b.setSpeakerMute(groupID, speakerID, payload)
+			}
+		}
+	}
+}
+
+// isSubscribed returns whether the Bridge still takes commands from a topic.
+func (b *Bridge) isSubscribed(topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscriptions[topic]
+}
+
+// isCommand returns whether a message on an actuated topic is a new command, rather than an echo or stale state.
+//
+// A message carrying a payload the Bridge published, or in actuate-only mode, expects an observer to publish, is its echo.
+// Each pending payload is consumed by the first message carrying it, along with any published before it, so a later command with the same payload is still taken as one.
+// Retained messages on a topic are desired state the first time the Bridge receives them, as they were set while it wasn't running.
+// After that, a retained message is only delivered on resubscribing, e.g. after the broker restarts, so it predates the Snapserver state the Bridge has seen since.
+// Such conflicts are resolved in favor of the Snapserver: the message is ignored, and if the Bridge is also observing, it republishes the Snapserver's state over it.
+func (b *Bridge) isCommand(topic string, msg message) bool {
+	b.mu.Lock()
+	stale := msg.Retained && b.received[topic]
+	b.received[topic] = true
+
+	echo := false
+	for i, payload := range b.pending[topic] {
+		if payload == msg.Payload {
+			b.pending[topic] = b.pending[topic][i+1:]
+			echo = true
+			break
+		}
+	}
+	state, known := b.state[topic]
+	b.mu.Unlock()
+
+	if echo {
+		return false
+	}
+	if stale {
+		if known && msg.Payload != state && b.opts.Mode&Observe != 0 {
+			log.Printf("ignoring stale retained %q on %v, restoring %q", msg.Payload, topic, state)
+			if err := b.publish(topic, state); err != nil {
+				log.Printf("could not restore %v: %v", topic, err)
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (b *Bridge) setInput(groupID, payload string) {
+	stream := snapcast.StreamID(payload)
+
+	b.withGroup(groupID, func(ctx context.Context, snapserver snapcast.Client, group snapcast.Group) {
+		if group.Stream == stream {
+			// Don't set it twice.
+			return
+		}
+
+		if err := snapserver.SetGroupStream(ctx, group.ID, stream); err != nil {
+			log.Printf("could not set group %v stream to %q: %v", group.ID, payload, err)
+			return
+		}
+		log.Printf("set group %v stream to %q", group.ID, payload)
+	})
+}
+
+// setSpeakerVolume sets a speaker's volume, either immediately, e.g. "30", or as a fade, e.g. "30 over 10s".
+func (b *Bridge) setSpeakerVolume(groupID, speakerID, payload string) {
+	cmd, err := parseVolumeCommand(payload)
+	if err != nil {
+		log.Printf("invalid volume %q for speaker %v: %v", payload, speakerID, err)
+		return
+	}
+
+	b.cancelFade(speakerID)
+	b.cancelFade(groupFadeKey(groupID))
+	if cmd.duration > 0 {
+		b.startFade(speakerID, func(ctx context.Context, snapserver snapcast.Client) error {
+			return snapcast.FadeSpeaker(ctx, snapserver, speakerID, cmd.percent, cmd.duration, cmd.curve)
+		})
+		return
+	}
+
+	b.updateSpeakerVolume(groupID, speakerID, func(v *snapcast.Volume) {
+		v.Percent = cmd.percent
+	})
+}
+
+func (b *Bridge) setSpeakerMute(groupID, speakerID, payload string) {
+	muted, err := strconv.ParseBool(strings.TrimSpace(payload))
+	if err != nil {
+		log.Printf("invalid mute %q for speaker %v", payload, speakerID)
+		return
+	}
+
+	// A fade would overwrite the mute on its next step.
+	b.cancelFade(speakerID)
+	b.cancelFade(groupFadeKey(groupID))
+
+	b.updateSpeakerVolume(groupID, speakerID, func(v *snapcast.Volume) {
+		v.Muted = muted
+	})
+}
+
+// setGroupVolume sets a group's volume, scaling its speakers proportionally, either immediately or as a fade, as setSpeakerVolume.
+func (b *Bridge) setGroupVolume(groupID, payload string) {
+	cmd, err := parseVolumeCommand(payload)
+	if err != nil {
+		log.Printf("invalid group %v volume %q: %v", groupID, payload, err)
+		return
+	}
+
+	b.cancelFade(groupFadeKey(groupID))
+	b.mu.Lock()
+	speakers := b.groups[groupID].Speakers
+	b.mu.Unlock()
+	for _, speaker := range speakers {
+		b.cancelFade(speaker.ID)
+	}
+
+	if cmd.duration > 0 {
+		b.startFade(groupFadeKey(groupID), func(ctx context.Context, snapserver snapcast.Client) error {
+			return snapcast.FadeGroup(ctx, snapserver, groupID, cmd.percent, cmd.duration, cmd.curve)
+		})
+		return
+	}
+
+	b.withGroup(groupID, func(ctx context.Context, snapserver snapcast.Client, group snapcast.Group) {
+		if group.Volume() == cmd.percent {
+			// Don't set it twice.
+			return
+		}
+
+		if err := snapcast.SetGroupVolume(ctx, snapserver, group.ID, cmd.percent); err != nil {
+			log.Printf("could not set group %v volume to %d: %v", group.ID, cmd.percent, err)
+			return
+		}
+		log.Printf("set group %v volume to %d", group.ID, cmd.percent)
+	})
+}
+
+// updateSpeakerVolume applies f to the current volume of a speaker in a group, and sets it if it changed.
+func (b *Bridge) updateSpeakerVolume(groupID, speakerID string, f func(*snapcast.Volume)) {
+	b.withGroup(groupID, func(ctx context.Context, snapserver snapcast.Client, group snapcast.Group) {
+		for _, speaker := range group.Speakers {
+			if speaker.ID != speakerID {
+				continue
+			}
+
+			volume := speaker.Volume
+			f(&volume)
+			if volume == speaker.Volume {
+				// Don't set it twice.
+				return
+			}
+
+			if err := snapserver.SetSpeakerVolume(ctx, speakerID, volume); err != nil {
+				log.Printf("could not set speaker %v volume to %+v: %v", speakerID, volume, err)
+				return
+			}
+			log.Printf("set speaker %v volume to %+v", speakerID, volume)
+			return
+		}
+		log.Printf("could not find speaker %v", speakerID)
+	})
+}
+
+// restoreScene restores a scene by name, then resyncs, as the group may have changed.
+func (b *Bridge) restoreScene(payload string) {
+	name := strings.TrimSpace(payload)
+
+	scene, err := scenes.Load(b.cfg().Scenes.Dir, name)
+	if err != nil {
+		log.Printf("could not load scene: %v", err)
+		return
+	}
+
+	b.mu.Lock()
+	snapserver := b.snapserver
+	b.mu.Unlock()
+	if snapserver == nil {
+		log.Print("not connected to Snapserver")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := scenes.Restore(ctx, snapserver, scene); err != nil {
+		log.Printf("could not restore scene: %v", err)
+		return
+	}
+	log.Printf("restored scene %q", name)
+
+	// Resync outside of the MQTT message handler, as it resubscribes.
+	go func() {
+		if err := b.connected(snapserver); err != nil {
+			log.Printf("could not resync Snapserver after restoring scene: %v", err)
+		}
+	}()
+}
+
+// withGroup calls f with the current Snapserver connection and the current state of a group.
+func (b *Bridge) withGroup(groupID string, f func(context.Context, snapcast.Client, snapcast.Group)) {
+	b.mu.Lock()
+	snapserver := b.snapserver
+	b.mu.Unlock()
+
+	if snapserver == nil {
+		log.Print("not connected to Snapserver")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	groups, err := snapserver.Groups(ctx)
+	if err != nil {
+		log.Printf("could not get existing groups: %v", err)
+		return
+	}
+	b.checker.MarkStatus()
+	metrics.ObserveGroups(groups)
+
+	group, ok := groups[groupID]
+	if !ok {
+		log.Printf("could not find group %v", groupID)
+		return
+	}
+
+	f(ctx, snapserver, group)
+}
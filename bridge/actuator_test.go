@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import "testing"
+
+func TestIsCommand(t *testing.T) {
+	const topic = "home/kitchen/volume"
+
+	b := New(nil, Options{Mode: Actuate})
+
+	// Each step records the state an observer is expected to publish, if any, then receives a message.
+	steps := []struct {
+		name  string
+		state []string
+		msg   message
+		want  bool
+	}{
+		{
+			name: "retained desired state at startup",
+			msg:  message{Payload: "30", Retained: true},
+			want: true,
+		},
+		{
+			name:  "echo of a fade's first step",
+			state: []string{"40", "45", "50"},
+			msg:   message{Payload: "40"},
+			want:  false,
+		},
+		{
+			name: "echo of a fade's second step",
+			msg:  message{Payload: "45"},
+			want: false,
+		},
+		{
+			name: "echo of a fade's last step",
+			msg:  message{Payload: "50"},
+			want: false,
+		},
+		{
+			name: "returning to a recent value",
+			msg:  message{Payload: "45"},
+			want: true,
+		},
+		{
+			name:  "a command while an echo is pending",
+			state: []string{"60"},
+			msg:   message{Payload: "20"},
+			want:  true,
+		},
+		{
+			name: "the pending echo",
+			msg:  message{Payload: "60"},
+			want: false,
+		},
+		{
+			name:  "echo after a skipped one",
+			state: []string{"70", "80"},
+			msg:   message{Payload: "80"},
+			want:  false,
+		},
+		{
+			name: "the skipped value, as a command",
+			msg:  message{Payload: "70"},
+			want: true,
+		},
+		{
+			name: "retained state redelivered on resubscribing",
+			msg:  message{Payload: "10", Retained: true},
+			want: false,
+		},
+	}
+	for _, step := range steps {
+		for _, payload := range step.state {
+			if err := b.publishState(topic, payload); err != nil {
+				t.Fatalf("publishState(%v) returned error: %v", payload, err)
+			}
+		}
+		if got := b.isCommand(topic, step.msg); got != step.want {
+			t.Errorf("%s: isCommand(%+v) = %v, want %v", step.name, step.msg, got, step.want)
+		}
+	}
+}
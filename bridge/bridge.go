@@ -0,0 +1,557 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// Package bridge connects Catbus to a Snapserver.
+//
+// It observes the Snapserver and publishes its state to Catbus, actuates the Snapserver from Catbus, or both,
+// over one MQTT client and one Snapserver connection.
+// It can also move a stream between groups as people move between rooms.
+package bridge
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/availability"
+	"go.eth.moe/catbus-snapcast/config"
+	"go.eth.moe/catbus-snapcast/health"
+	"go.eth.moe/catbus-snapcast/metrics"
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+type (
+	// Mode is which directions a Bridge runs in.
+	Mode int
+
+	// Options are options for a Bridge.
+	Options struct {
+		Mode Mode
+
+		// Name identifies the daemon, for its availability topic and to the MQTT broker.
+		Name string
+
+		// HTTPAddr is the address to serve /metrics, /healthz, and /readyz on, if set.
+		HTTPAddr string
+
+		// ConfigPath is where the config was loaded from, to reload it on SIGHUP.
+		ConfigPath string
+		// ConfigOverrides are reapplied when the config is reloaded.
+		ConfigOverrides config.Overrides
+		// WatchConfig also reloads the config when the file at ConfigPath is modified.
+		WatchConfig bool
+	}
+
+	// Bridge connects Catbus to a Snapserver.
+	Bridge struct {
+		opts    Options
+		checker *health.Checker
+
+		mu         sync.Mutex
+		config     *config.Config
+		broker     messageBroker
+		snapserver snapcast.Client
+		// groups are all of the Snapserver's groups, by group ID, renamed by config.Disambiguate so that their topics are distinct.
+		groups map[string]snapcast.Group
+
+		// state is the payload last published to each topic, or in actuate-only mode, expected to be published by an observer.
+		state map[string]string
+		// pending are the payloads published to each topic that the Bridge has yet to receive back, oldest first.
+		pending map[string][]string
+		// received are the topics the Bridge has received a message on since it started.
+		received map[string]bool
+		// subscriptions are the topics the Bridge currently takes commands from.
+		subscriptions map[string]bool
+		// fades are the running volume fades, by speaker ID.
+		fades map[string]*fade
+		// sleepTimers are the running sleep timers, by group ID.
+		sleepTimers map[string]*sleepTimer
+		// occupied is whether each group's room is occupied, by group ID, for follow-me mode.
+		occupied map[string]bool
+		// leftBehind are the groups muted for being left behind by the follow-me stream.
+		leftBehind map[string]bool
+		// follow is the debounce timer before moving the follow-me stream, if presence has changed.
+		follow *time.Timer
+		// groupVolumes are the debounce timers before publishing each group's volume, by group ID.
+		groupVolumes map[string]*time.Timer
+	}
+)
+
+const (
+	// Observe publishes the Snapserver's state to Catbus.
+	Observe = Mode(1 << iota)
+	// Actuate sets the Snapserver's state from Catbus.
+	Actuate
+
+	// FollowMe moves a stream to whichever groups' rooms are occupied, and mutes the groups left behind.
+	FollowMe
+
+	// Both observes and actuates.
+	Both = Observe | Actuate
+)
+
+const (
+	timeout             = 5 * time.Second
+	pollInterval        = 30 * time.Second
+	configWatchInterval = 5 * time.Second
+	reconnectDelay      = time.Second
+	maxReconnectDelay   = time.Minute
+	// maxPending is how many payloads per topic the Bridge waits to receive back, in case an observer never publishes them.
+	maxPending = 64
+	// groupVolumeSettle is how long a group's speakers' volumes must stay put before the group's volume is published.
+	// It is shorter than a fade's steps, so fades still publish their progress.
+	groupVolumeSettle = 100 * time.Millisecond
+)
+
+// New returns a new Bridge.
+func New(config *config.Config, opts Options) *Bridge {
+	return &Bridge{
+		config:        config,
+		opts:          opts,
+		checker:       health.New(health.MQTT, health.Snapserver),
+		state:         map[string]string{},
+		pending:       map[string][]string{},
+		received:      map[string]bool{},
+		subscriptions: map[string]bool{},
+		fades:         map[string]*fade{},
+		sleepTimers:   map[string]*sleepTimer{},
+		occupied:      map[string]bool{},
+		leftBehind:    map[string]bool{},
+		groupVolumes:  map[string]*time.Timer{},
+	}
+}
+
+// Run runs the Bridge until the process is signalled to stop.
+func (b *Bridge) Run() {
+	go b.checker.WatchSystemd(context.Background())
+
+	if b.opts.HTTPAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Default)
+		b.checker.Register(mux)
+		go func() {
+			log.Printf("serving HTTP on %v", b.opts.HTTPAddr)
+			if err := http.ListenAndServe(b.opts.HTTPAddr, mux); err != nil {
+				log.Fatalf("could not serve HTTP: %v", err)
+			}
+		}()
+	}
+
+	cfg := b.cfg()
+	if b.opts.Mode&FollowMe != 0 && cfg.Topics.Presence == "" {
+		log.Fatal("follow-me mode needs topics.presence")
+	}
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		log.Fatalf("could not set up MQTT TLS: %v", err)
+	}
+
+	// The broker must exist before anything that publishes or subscribes, such as a reload, can run.
+	mqttConnected := false
+	broker := newBroker(cfg.BrokerURI, brokerOptions{
+		Username:  cfg.MQTT.Username,
+		Password:  cfg.MQTT.Password,
+		ClientID:  clientID(cfg.MQTT.ClientID, b.opts.Name),
+		KeepAlive: cfg.MQTT.KeepAlive,
+		TLSConfig: tlsConfig,
+
+		DisconnectHandler: func(err error) {
+			log.Printf("disconnected from MQTT broker %s: %v", b.cfg().BrokerAddress(), err)
+			b.checker.SetUp(health.MQTT, false)
+		},
+		ConnectHandler: func() {
+			log.Printf("connected to MQTT broker %s", b.cfg().BrokerAddress())
+			b.checker.SetUp(health.MQTT, true)
+			if mqttConnected {
+				metrics.Reconnects.Inc(metrics.MQTT)
+			}
+			mqttConnected = true
+
+			if b.opts.Mode&(Actuate|FollowMe) != 0 {
+				b.subscribe()
+			}
+		},
+	})
+	b.mu.Lock()
+	b.broker = broker
+	b.mu.Unlock()
+
+	// Daemons in different modes can share a config, so a configured client ID gets the mode's name, as the main connection's does.
+	availabilityClientID := ""
+	if cfg.MQTT.ClientID != "" {
+		availabilityClientID = clientID(cfg.MQTT.ClientID, b.opts.Name)
+	}
+	avail := availability.NewPublisherWithOptions(cfg.BrokerURI, b.availabilityTopic(b.opts.Name), "catbus-snapcast-"+b.opts.Name, availability.Options{
+		Username:  cfg.MQTT.Username,
+		Password:  cfg.MQTT.Password,
+		ClientID:  availabilityClientID,
+		KeepAlive: cfg.MQTT.KeepAlive,
+		TLSConfig: tlsConfig,
+	})
+	if err := avail.Connect(); err != nil {
+		log.Printf("could not connect to MQTT broker for availability: %v", err)
+	}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				b.reloadConfig()
+				continue
+			}
+
+			log.Printf("received %v, going offline", sig)
+			b.shutdown()
+			if err := avail.Close(); err != nil {
+				log.Printf("could not publish availability: %v", err)
+			}
+			os.Exit(0)
+		}
+	}()
+
+	if b.opts.WatchConfig && b.opts.ConfigPath != "" {
+		go b.watchConfig()
+	}
+
+	go func() {
+		log.Printf("connecting to MQTT broker %v", cfg.BrokerAddress())
+		if err := broker.Connect(); err != nil {
+			log.Fatalf("could not connect to MQTT broker: %v", err)
+		}
+	}()
+
+	snapserverConnected := false
+	delay := reconnectDelay
+	for {
+		snapserver, err := b.dialSnapserver()
+		if err != nil {
+			log.Printf("could not connect to Snapserver, retrying in %v: %v", delay, err)
+			delay = backoff(delay)
+			continue
+		}
+		snapserver = newEchoingClient(snapserver)
+		if snapserverConnected {
+			metrics.Reconnects.Inc(metrics.Snapserver)
+		}
+		snapserverConnected = true
+
+		if err := b.connected(snapserver); err != nil {
+			log.Printf("could not set up Snapserver, retrying in %v: %v", delay, err)
+			snapserver.Close()
+			delay = backoff(delay)
+			continue
+		}
+		delay = reconnectDelay
+
+		pollCtx, stopPolling := context.WithCancel(context.Background())
+		go b.pollGroups(pollCtx, snapserver)
+
+		if err := snapserver.Wait(); err != nil {
+			log.Printf("disconnected from Snapserver: %v", err)
+		}
+		stopPolling()
+		b.disconnected()
+	}
+}
+
+// backoff sleeps for delay, and returns the delay to use next time, doubling up to maxReconnectDelay.
+func backoff(delay time.Duration) time.Duration {
+	time.Sleep(delay)
+	if delay *= 2; delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	return delay
+}
+
+// Reload switches the Bridge to a new config, resubscribing and republishing as needed.
+// Changes to the MQTT broker or availability topic only take effect after a restart.
+func (b *Bridge) Reload(newConfig *config.Config) {
+	changes := b.cfg().Diff(newConfig)
+	if len(changes) == 0 {
+		log.Print("config unchanged")
+		return
+	}
+	log.Printf("config changed: %v", strings.Join(changes, ", "))
+
+	for _, change := range changes {
+		if change == "BrokerURI" || strings.HasPrefix(change, "MQTT.") || change == "Topics.Availability" {
+			log.Printf("config change to %v will take effect after a restart", change)
+		}
+	}
+
+	b.mu.Lock()
+	b.config = newConfig
+	snapserver := b.snapserver
+	b.mu.Unlock()
+
+	if snapserver == nil {
+		if b.opts.Mode&(Actuate|FollowMe) != 0 {
+			b.subscribe()
+		}
+		return
+	}
+	if err := b.connected(snapserver); err != nil {
+		log.Printf("could not resync Snapserver after reloading config: %v", err)
+	}
+}
+
+// reloadConfig reloads the config from ConfigPath, keeping the running config if the new one is invalid.
+func (b *Bridge) reloadConfig() {
+	if b.opts.ConfigPath == "" {
+		return
+	}
+
+	log.Printf("reloading config from %v", b.opts.ConfigPath)
+	newConfig, err := config.Load(b.opts.ConfigPath, b.opts.ConfigOverrides)
+	if err != nil {
+		log.Printf("could not reload config, keeping the running config: %v", err)
+		return
+	}
+	b.Reload(newConfig)
+}
+
+// watchConfig reloads the config whenever its file's modification time changes.
+func (b *Bridge) watchConfig() {
+	var lastModified time.Time
+	if info, err := os.Stat(b.opts.ConfigPath); err == nil {
+		lastModified = info.ModTime()
+	}
+
+	for range time.Tick(configWatchInterval) {
+		info, err := os.Stat(b.opts.ConfigPath)
+		if err != nil {
+			log.Printf("could not watch config: %v", err)
+			continue
+		}
+		if info.ModTime().Equal(lastModified) {
+			continue
+		}
+		lastModified = info.ModTime()
+		b.reloadConfig()
+	}
+}
+
+// dialSnapserver connects to the configured Snapserver, or discovers one with mDNS.
+func (b *Bridge) dialSnapserver() (snapcast.Client, error) {
+	if addr := b.cfg().Snapcast.Address; addr != "" {
+		return snapcast.Dial(addr, metrics.ClientOptions())
+	}
+	return snapcast.DiscoverWithOptions(metrics.ClientOptions())
+}
+
+// cfg returns the running config.
+func (b *Bridge) cfg() *config.Config {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.config
+}
+
+// mqtt returns the Bridge's MQTT connection.
+func (b *Bridge) mqtt() messageBroker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.broker
+}
+
+// connected sets up a new Snapserver connection, or resyncs an existing one.
+func (b *Bridge) connected(snapserver snapcast.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	host, err := snapserver.Host(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("connected to Snapserver: %v", host)
+
+	streams, err := snapserver.Streams(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups, err := snapserver.Groups(ctx)
+	if err != nil {
+		return err
+	}
+	b.checker.MarkStatus()
+	metrics.ObserveGroups(groups)
+
+	cfg := b.cfg()
+	groups, problems := cfg.Disambiguate(groups)
+	for _, problem := range problems {
+		log.Print(problem)
+	}
+	if groupID := cfg.Snapcast.GroupID; groupID != "" {
+		if _, ok := groups[groupID]; !ok {
+			log.Printf("could not find group %v", groupID)
+		}
+	}
+
+	b.mu.Lock()
+	b.snapserver = snapserver
+	b.groups = groups
+	b.mu.Unlock()
+	b.checker.SetUp(health.Snapserver, true)
+
+	if b.opts.Mode&(Observe|Actuate) != 0 {
+		b.observe(snapserver, streams)
+	}
+	if b.opts.Mode&(Actuate|FollowMe) != 0 {
+		b.subscribe()
+	}
+	return nil
+}
+
+// disconnected tears down a Snapserver connection.
+func (b *Bridge) disconnected() {
+	b.mu.Lock()
+	b.snapserver = nil
+	for key, fade := range b.fades {
+		fade.cancel()
+		delete(b.fades, key)
+	}
+	b.mu.Unlock()
+	b.checker.SetUp(health.Snapserver, false)
+
+	if b.opts.Mode&Observe != 0 {
+		if err := b.publish(b.availabilityTopic("snapserver"), availability.Offline); err != nil {
+			log.Printf("could not publish Snapserver availability: %v", err)
+		}
+	}
+}
+
+// shutdown marks the Snapserver offline if the Bridge observes it, then disconnects from the MQTT broker.
+// Unlike the daemon's own availability, nothing else marks the Snapserver offline once the Bridge has gone.
+func (b *Bridge) shutdown() {
+	if b.opts.Mode&Observe != 0 {
+		if err := b.publish(b.availabilityTopic("snapserver"), availability.Offline); err != nil {
+			log.Printf("could not publish Snapserver availability: %v", err)
+		}
+	}
+	b.mqtt().Disconnect()
+}
+
+// pollGroups keeps the speaker metrics and the last Server.GetStatus time fresh, until ctx is done.
+// If any group's speakers or names change, it resyncs, so that their topics follow.
+func (b *Bridge) pollGroups(ctx context.Context, snapserver snapcast.Client) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		rctx, cancel := context.WithTimeout(ctx, timeout)
+		groups, err := snapserver.Groups(rctx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("could not poll Snapserver groups: %v", err)
+			continue
+		}
+		b.checker.MarkStatus()
+		metrics.ObserveGroups(groups)
+		groups, _ = b.cfg().Disambiguate(groups)
+
+		b.mu.Lock()
+		known := b.groups
+		b.mu.Unlock()
+		if !sameTopology(known, groups) {
+			log.Print("group speakers or names changed, resyncing")
+			if err := b.connected(snapserver); err != nil {
+				log.Printf("could not resync Snapserver: %v", err)
+			}
+		}
+	}
+}
+
+// sameTopology returns whether two snapshots of the Snapserver's groups have the same groups and speakers, with the same names.
+func sameTopology(a, b map[string]snapcast.Group) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, group := range a {
+		other, ok := b[id]
+		if !ok || group.Name != other.Name || len(group.Speakers) != len(other.Speakers) {
+			return false
+		}
+		for i := range group.Speakers {
+			if group.Speakers[i].ID != other.Speakers[i].ID || group.Speakers[i].Name != other.Speakers[i].Name {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// controlledGroups returns the groups the Bridge observes and actuates, in order of ID.
+func (b *Bridge) controlledGroups() []snapcast.Group {
+	b.mu.Lock()
+	groups := b.groups
+	b.mu.Unlock()
+
+	cfg := b.cfg()
+	var controlled []snapcast.Group
+	for _, group := range groups {
+		if cfg.ControlsGroup(group) {
+			controlled = append(controlled, group)
+		}
+	}
+	sort.Slice(controlled, func(i, j int) bool { return controlled[i].ID < controlled[j].ID })
+	return controlled
+}
+
+// publish publishes a retained value, recording the outcome.
+func (b *Bridge) publish(topic, payload string) error {
+	b.record(topic, payload)
+
+	err := b.mqtt().Publish(topic, payload)
+	if err != nil {
+		metrics.MQTTPublishes.Inc(metrics.Failure)
+		return err
+	}
+	metrics.MQTTPublishes.Inc(metrics.Success)
+	b.checker.MarkPublish()
+	return nil
+}
+
+func (b *Bridge) availabilityTopic(name string) string {
+	return path.Join(b.cfg().Topics.Availability, name)
+}
+
+// publishState publishes part of the Snapserver's state.
+// A Bridge that does not observe only records it, so as to recognise an observer's publishes of it as state rather than commands.
+func (b *Bridge) publishState(topic, payload string) error {
+	if b.opts.Mode&Observe == 0 {
+		b.record(topic, payload)
+		return nil
+	}
+	return b.publish(topic, payload)
+}
+
+// record remembers a payload as the state of a topic, and as pending until the Bridge receives it back.
+func (b *Bridge) record(topic, payload string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state[topic] = payload
+	pending := append(b.pending[topic], payload)
+	if len(pending) > maxPending {
+		pending = pending[len(pending)-maxPending:]
+	}
+	b.pending[topic] = pending
+}
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/config"
+	"go.eth.moe/catbus-snapcast/snapcast"
+	"go.eth.moe/catbus-snapcast/snapcast/snapcasttest"
+)
+
+// fakeBroker is an in-memory MQTT broker with a single client.
+// Like a real broker, it retains every payload, sends the retained payload to new subscriptions, and sends the client's own publishes back to it.
+type fakeBroker struct {
+	mu       sync.Mutex
+	retained map[string]string
+	handlers map[string]func(message)
+
+	// messages are delivered one at a time, in order, as broker delivers them.
+	messages chan func()
+}
+
+func newFakeBroker() *fakeBroker {
+	f := &fakeBroker{
+		retained: map[string]string{},
+		handlers: map[string]func(message){},
+		messages: make(chan func(), messageQueueSize),
+	}
+	go func() {
+		for deliver := range f.messages {
+			deliver()
+		}
+	}()
+	return f
+}
+
+func (f *fakeBroker) Publish(topic, payload string) error {
+	f.Send(topic, payload)
+	return nil
+}
+
+// Send publishes a retained payload, as any client could.
+func (f *fakeBroker) Send(topic, payload string) {
+	f.mu.Lock()
+	f.retained[topic] = payload
+	handler := f.handlers[topic]
+	f.mu.Unlock()
+
+	if handler != nil {
+		f.messages <- func() { handler(message{Topic: topic, Payload: payload}) }
+	}
+}
+
+func (f *fakeBroker) Subscribe(topic string, handler func(message)) error {
+	f.mu.Lock()
+	f.handlers[topic] = handler
+	payload, ok := f.retained[topic]
+	f.mu.Unlock()
+
+	if ok {
+		f.messages <- func() { handler(message{Topic: topic, Payload: payload, Retained: true}) }
+	}
+	return nil
+}
+
+func (f *fakeBroker) Unsubscribe(topic string) error {
+	f.mu.Lock()
+	delete(f.handlers, topic)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeBroker) Disconnect() {}
+
+// Retained returns the payload retained on a topic.
+func (f *fakeBroker) Retained(topic string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.retained[topic]
+}
+
+// waitFor fails the test if cond doesn't become true soon.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRoundTrip runs a Bridge that both observes and actuates against a fake Snapserver and broker,
+// checking that commands reach the Snapserver, that changes made elsewhere reach MQTT, and that neither echoes back as the other.
+func TestRoundTrip(t *testing.T) {
+	cfg, err := config.Load("", config.Overrides{
+		"mqttBroker":          "tcp://localhost:1883",
+		"topics.input":        "home/{group.name}/input",
+		"topics.availability": "home/availability",
+		"snapcast.groupId":    "g1",
+	})
+	if err != nil {
+		t.Fatalf("could not load config: %v", err)
+	}
+
+	s, err := snapcasttest.NewServer()
+	if err != nil {
+		t.Fatalf("could not start fake Snapserver: %v", err)
+	}
+	defer s.Close()
+	s.AddStream(snapcast.Stream{ID: "radio", Status: "playing"})
+	s.AddStream(snapcast.Stream{ID: "tv", Status: "playing"})
+	group := snapcast.Group{
+		ID:     "g1",
+		Name:   "kitchen",
+		Stream: "radio",
+		Speakers: []snapcast.Speaker{
+			{ID: "s1", Name: "fridge", Connected: true, Volume: snapcast.Volume{Percent: 40}},
+		},
+	}
+	s.AddGroup(group)
+	speaker := group.Speakers[0]
+
+	snapserver, err := s.Dial()
+	if err != nil {
+		t.Fatalf("could not dial fake Snapserver: %v", err)
+	}
+	defer snapserver.Close()
+
+	broker := newFakeBroker()
+	b := New(cfg, Options{Mode: Both, Name: "test"})
+	b.broker = broker
+	if err := b.connected(newEchoingClient(snapserver)); err != nil {
+		t.Fatalf("connected() returned error: %v", err)
+	}
+
+	inputTopic := cfg.InputTopic(group)
+	volumeTopic := cfg.SpeakerVolumeTopic(group, speaker)
+	retained := func(topic, want string) func() bool {
+		return func() bool { return broker.Retained(topic) == want }
+	}
+	stream := func(want snapcast.StreamID) func() bool {
+		return func() bool { return s.Groups()["g1"].Stream == want }
+	}
+	volume := func(want int) func() bool {
+		return func() bool { return s.Groups()["g1"].Speakers[0].Volume.Percent == want }
+	}
+
+	waitFor(t, "the stream to be observed", retained(inputTopic, "radio"))
+	waitFor(t, "the volume to be observed", retained(volumeTopic, "40"))
+
+	// Commands reach the Snapserver, and the new state is published back.
+	broker.Send(inputTopic, "tv")
+	waitFor(t, "the stream command to be actuated", stream("tv"))
+	broker.Send(volumeTopic, "55")
+	waitFor(t, "the volume command to be actuated", volume(55))
+
+	// Another controller's changes are published, and their echoes are not taken as commands.
+	if err := s.SetGroupStream("g1", "radio"); err != nil {
+		t.Fatalf("Server.SetGroupStream() returned error: %v", err)
+	}
+	waitFor(t, "the stream change to be observed", retained(inputTopic, "radio"))
+	if err := s.SetSpeakerVolume("s1", snapcast.Volume{Percent: 20}); err != nil {
+		t.Fatalf("Server.SetSpeakerVolume() returned error: %v", err)
+	}
+	waitFor(t, "the volume change to be observed", retained(volumeTopic, "20"))
+
+	// Returning to a recent value is still a command.
+	broker.Send(inputTopic, "tv")
+	waitFor(t, "the repeated stream command to be actuated", stream("tv"))
+
+	// Give any echo a chance to flip the Snapserver back, then check that none did.
+	time.Sleep(100 * time.Millisecond)
+	if got := s.Groups()["g1"]; got.Stream != "tv" || got.Speakers[0].Volume.Percent != 20 {
+		t.Errorf("Snapserver has stream %v and volume %v, want tv and 20", got.Stream, got.Speakers[0].Volume.Percent)
+	}
+	if got := broker.Retained(inputTopic); got != "tv" {
+		t.Errorf("%v is %q, want tv", inputTopic, got)
+	}
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"context"
+	"sync"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+// echoingClient is a Snapserver connection that passes the Bridge's own stream and volume changes to its notification handlers,
+// as the Snapserver only notifies its other clients of them.
+// This keeps the Bridge's record of the state an observer publishes up to date through its own commands and fades.
+type echoingClient struct {
+	snapcast.Client
+
+	mu                   sync.Mutex
+	groupStreamChanged   func(string, snapcast.StreamID)
+	speakerVolumeChanged func(string, snapcast.Volume)
+}
+
+func newEchoingClient(client snapcast.Client) *echoingClient {
+	return &echoingClient{Client: client}
+}
+
+func (c *echoingClient) SetGroupStreamChangedHandler(f func(string, snapcast.StreamID)) {
+	c.mu.Lock()
+	c.groupStreamChanged = f
+	c.mu.Unlock()
+	c.Client.SetGroupStreamChangedHandler(f)
+}
+
+func (c *echoingClient) SetSpeakerVolumeChangedHandler(f func(string, snapcast.Volume)) {
+	c.mu.Lock()
+	c.speakerVolumeChanged = f
+	c.mu.Unlock()
+	c.Client.SetSpeakerVolumeChangedHandler(f)
+}
+
+func (c *echoingClient) SetGroupStream(ctx context.Context, groupID string, stream snapcast.StreamID) error {
+	if err := c.Client.SetGroupStream(ctx, groupID, stream); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	handler := c.groupStreamChanged
+	c.mu.Unlock()
+	if handler != nil {
+		handler(groupID, stream)
+	}
+	return nil
+}
+
+func (c *echoingClient) SetSpeakerVolume(ctx context.Context, speakerID string, volume snapcast.Volume) error {
+	if err := c.Client.SetSpeakerVolume(ctx, speakerID, volume); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	handler := c.speakerVolumeChanged
+	c.mu.Unlock()
+	if handler != nil {
+		handler(speakerID, volume)
+	}
+	return nil
+}
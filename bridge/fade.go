@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+type (
+	// volumeCommand is a parsed volume payload.
+	volumeCommand struct {
+		percent  int
+		duration time.Duration
+		curve    snapcast.Curve
+	}
+
+	// fade is a running volume fade.
+	fade struct {
+		cancel context.CancelFunc
+	}
+)
+
+// parseVolumeCommand parses a volume payload: a percentage, optionally followed by "over" a duration and a curve,
+// e.g. "30", "30 over 10s", or "30 over 10m ease-in".
+func parseVolumeCommand(payload string) (volumeCommand, error) {
+	fields := strings.Fields(payload)
+	if len(fields) != 1 && len(fields) != 3 && len(fields) != 4 {
+		return volumeCommand{}, errors.New(`must be "<percent>" or "<percent> over <duration> [<curve>]"`)
+	}
+
+	cmd := volumeCommand{curve: snapcast.Linear}
+
+	percent, err := strconv.Atoi(fields[0])
+	if err != nil || percent < 0 || percent > 100 {
+		return volumeCommand{}, errors.New("volume must be a percentage")
+	}
+	cmd.percent = percent
+
+	if len(fields) == 1 {
+		return cmd, nil
+	}
+
+	if fields[1] != "over" {
+		return volumeCommand{}, fmt.Errorf(`expected "over", got %q`, fields[1])
+	}
+	duration, err := time.ParseDuration(fields[2])
+	if err != nil || duration < 0 {
+		return volumeCommand{}, fmt.Errorf("invalid duration %q", fields[2])
+	}
+	cmd.duration = duration
+
+	if len(fields) == 4 {
+		curve, ok := snapcast.Curves[fields[3]]
+		if !ok {
+			return volumeCommand{}, fmt.Errorf("unknown curve %q", fields[3])
+		}
+		cmd.curve = curve
+	}
+	return cmd, nil
+}
+
+// groupFadeKey returns the key of a group's fade, distinct from any speaker's.
+func groupFadeKey(groupID string) string {
+	return "group " + groupID
+}
+
+// startFade runs a fade in the background, until it finishes, is cancelled by cancelFade, or the Snapserver disconnects.
+func (b *Bridge) startFade(key string, f func(context.Context, snapcast.Client) error) {
+	b.mu.Lock()
+	snapserver := b.snapserver
+	if snapserver == nil {
+		b.mu.Unlock()
+		log.Print("not connected to Snapserver")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	fd := &fade{cancel: cancel}
+	b.fades[key] = fd
+	b.mu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		log.Printf("fading %v", key)
+		err := f(ctx, snapserver)
+		switch {
+		case errors.Is(err, context.Canceled):
+			log.Printf("cancelled fading %v", key)
+		case err != nil:
+			log.Printf("could not fade %v: %v", key, err)
+		default:
+			log.Printf("faded %v", key)
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// Only forget the fade if it has not been replaced.
+		if b.fades[key] == fd {
+			delete(b.fades, key)
+		}
+	}()
+}
+
+// cancelFade stops a running fade, if any.
+func (b *Bridge) cancelFade(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if fade, ok := b.fades[key]; ok {
+		fade.cancel()
+		delete(b.fades, key)
+	}
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+func TestParseVolumeCommand(t *testing.T) {
+	tests := []struct {
+		payload      string
+		wantPercent  int
+		wantDuration time.Duration
+		wantCurve    snapcast.Curve
+		wantErr      bool
+	}{
+		{payload: "30", wantPercent: 30, wantCurve: snapcast.Linear},
+		{payload: " 0 ", wantPercent: 0, wantCurve: snapcast.Linear},
+		{payload: "100", wantPercent: 100, wantCurve: snapcast.Linear},
+		{payload: "30 over 10s", wantPercent: 30, wantDuration: 10 * time.Second, wantCurve: snapcast.Linear},
+		{payload: "30 over 10m ease-in", wantPercent: 30, wantDuration: 10 * time.Minute, wantCurve: snapcast.EaseIn},
+		{payload: "30 over 0s ease-in-out", wantPercent: 30, wantCurve: snapcast.EaseInOut},
+
+		{payload: "", wantErr: true},
+		{payload: "loud", wantErr: true},
+		{payload: "-1", wantErr: true},
+		{payload: "101", wantErr: true},
+		{payload: "30 over", wantErr: true},
+		{payload: "30 in 10s", wantErr: true},
+		{payload: "30 over soon", wantErr: true},
+		{payload: "30 over -10s", wantErr: true},
+		{payload: "30 over 10s bouncy", wantErr: true},
+		{payload: "30 over 10s ease-in extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		cmd, err := parseVolumeCommand(tt.payload)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseVolumeCommand(%q) returned nil error, want error", tt.payload)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseVolumeCommand(%q) returned error: %v", tt.payload, err)
+			continue
+		}
+		if cmd.percent != tt.wantPercent || cmd.duration != tt.wantDuration {
+			t.Errorf("parseVolumeCommand(%q) = %d over %v, want %d over %v", tt.payload, cmd.percent, cmd.duration, tt.wantPercent, tt.wantDuration)
+		}
+		// Funcs can't be compared directly.
+		if reflect.ValueOf(cmd.curve).Pointer() != reflect.ValueOf(tt.wantCurve).Pointer() {
+			t.Errorf("parseVolumeCommand(%q) returned the wrong curve", tt.payload)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/metrics"
+)
+
+// presenceValues are the presence payloads accepted besides those of strconv.ParseBool.
+var presenceValues = map[string]bool{
+	"occupied":   true,
+	"unoccupied": false,
+	"on":         true,
+	"off":        false,
+}
+
+// presenceHandlers adds handlers for the presence topic of every group on the Snapserver.
+func (b *Bridge) presenceHandlers(handlers map[string]func(string)) {
+	b.mu.Lock()
+	groups := b.groups
+	b.mu.Unlock()
+
+	cfg := b.cfg()
+	if cfg.Topics.Presence == "" {
+		return
+	}
+	for _, group := range groups {
+		groupID := group.ID
+		handlers[cfg.PresenceTopic(group)] = func(payload string) {
+			b.setPresence(groupID, payload)
+		}
+	}
+}
+
+// parsePresence parses whether a room is occupied.
+func parsePresence(payload string) (bool, bool) {
+	payload = strings.ToLower(strings.TrimSpace(payload))
+	if occupied, ok := presenceValues[payload]; ok {
+		return occupied, true
+	}
+	occupied, err := strconv.ParseBool(payload)
+	return occupied, err == nil
+}
+
+// setPresence records whether a group's room is occupied, and moves the follow-me stream once presence has been stable for the debounce.
+func (b *Bridge) setPresence(groupID, payload string) {
+	occupied, ok := parsePresence(payload)
+	if !ok {
+		log.Printf("invalid presence %q for group %v", payload, groupID)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if was, ok := b.occupied[groupID]; ok && was == occupied {
+		return
+	}
+	b.occupied[groupID] = occupied
+
+	if b.follow != nil {
+		b.follow.Stop()
+	}
+	b.follow = time.AfterFunc(b.config.FollowMe.Debounce, b.followPresence)
+}
+
+// followPresence moves the follow-me stream to every group whose room is occupied, and mutes the groups playing it whose rooms are not.
+// Groups are only unmuted if the stream has just moved to them, or if they were muted for being left behind,
+// so that a group muted by hand stays muted.
+func (b *Bridge) followPresence() {
+	b.mu.Lock()
+	snapserver := b.snapserver
+	occupied := map[string]bool{}
+	for id, o := range b.occupied {
+		occupied[id] = o
+	}
+	b.mu.Unlock()
+
+	if snapserver == nil {
+		log.Print("could not follow presence: not connected to Snapserver")
+		return
+	}
+
+	stream := b.cfg().FollowMe.Stream
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	groups, err := snapserver.Groups(ctx)
+	if err != nil {
+		log.Printf("could not follow presence: could not get groups: %v", err)
+		return
+	}
+	b.checker.MarkStatus()
+	metrics.ObserveGroups(groups)
+
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		group := groups[id]
+
+		b.mu.Lock()
+		leftBehind := b.leftBehind[id]
+		b.mu.Unlock()
+
+		switch {
+		case occupied[id]:
+			moved := false
+			if group.Stream != stream {
+				log.Printf("moving %v to group %v", stream, id)
+				if err := snapserver.SetGroupStream(ctx, id, stream); err != nil {
+					log.Printf("could not move %v to group %v: %v", stream, id, err)
+					continue
+				}
+				moved = true
+			}
+			if group.Muted && (moved || leftBehind) {
+				if err := snapserver.SetGroupMute(ctx, id, false); err != nil {
+					log.Printf("could not unmute group %v: %v", id, err)
+					continue
+				}
+			}
+			b.setLeftBehind(id, false)
+
+		case group.Stream == stream && !group.Muted:
+			log.Printf("muting group %v, left behind by %v", id, stream)
+			if err := snapserver.SetGroupMute(ctx, id, true); err != nil {
+				log.Printf("could not mute group %v: %v", id, err)
+				continue
+			}
+			b.setLeftBehind(id, true)
+		}
+	}
+}
+
+// setLeftBehind records whether a group was muted for being left behind by the follow-me stream.
+func (b *Bridge) setLeftBehind(groupID string, leftBehind bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if leftBehind {
+		b.leftBehind[groupID] = true
+	} else {
+		delete(b.leftBehind, groupID)
+	}
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"go.eth.moe/catbus-snapcast/config"
+	"go.eth.moe/flag"
+)
+
+// Modes are the modes a Bridge can run in, by the names used for -mode and the per-mode commands.
+var Modes = map[string]Mode{
+	"bridge":    Both,
+	"actuator":  Actuate,
+	"observer":  Observe,
+	"follow-me": FollowMe,
+}
+
+// Main is the entry point of the catbus-snapcast commands.
+// It parses the flags, loads the config, and runs a Bridge in the named mode until the process is signalled to stop.
+// If mode is empty, it is chosen with the -mode flag.
+func Main(mode string) {
+	configPath := flag.Custom("config-path", "", "path to the config file, as .json, .yaml, or .toml (optional if every required setting is in the environment or flags)", optionalString)
+	checkConfig := flag.Custom("check-config", "false", "report every problem with the config and exit, non-zero if there are any", parseBool)
+	watchConfig := flag.Custom("watch-config", "false", "reload the config when config-path is modified, as well as on SIGHUP", parseBool)
+	httpAddr := flag.Custom("http-addr", "", "address to serve /metrics, /healthz, and /readyz on, e.g. :9090 (optional)", optionalString)
+
+	var modeFlag *interface{}
+	if mode == "" {
+		modeFlag = flag.Custom("mode", "bridge", "bridge (both directions), actuator (Catbus to Snapcast), observer (Snapcast to Catbus), or follow-me (move followMe.stream between groups on presence)", parseMode)
+	}
+
+	// configFlags override each config setting, keyed by config.Field.Key.
+	configFlags := map[string]*interface{}{}
+	for _, field := range config.Fields {
+		configFlags[field.Key] = flag.Custom(field.Flag, "", fmt.Sprintf("%s (overrides $%s and %s in the config file)", field.Usage, field.Env, field.Key), optionalString)
+	}
+
+	flag.Parse()
+
+	if modeFlag != nil {
+		mode, _ = (*modeFlag).(string)
+		if mode == "" {
+			mode = "bridge"
+		}
+	}
+	if _, ok := Modes[mode]; !ok {
+		log.Fatalf("unknown mode %q", mode)
+	}
+
+	overrides := config.Overrides{}
+	for key, f := range configFlags {
+		if v, _ := (*f).(string); v != "" {
+			overrides[key] = v
+		}
+	}
+
+	configPathValue, _ := (*configPath).(string)
+	cfg, err := config.Load(configPathValue, overrides)
+	if check, _ := (*checkConfig).(bool); check {
+		reportConfig(err)
+	}
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	httpAddrValue, _ := (*httpAddr).(string)
+	watchConfigValue, _ := (*watchConfig).(bool)
+	New(cfg, Options{
+		Mode:     Modes[mode],
+		Name:     mode,
+		HTTPAddr: httpAddrValue,
+
+		ConfigPath:      configPathValue,
+		ConfigOverrides: overrides,
+		WatchConfig:     watchConfigValue,
+	}).Run()
+}
+
+// reportConfig prints every problem with the config, and exits non-zero if there are any.
+func reportConfig(err error) {
+	if err == nil {
+		fmt.Println("config is valid")
+		os.Exit(0)
+	}
+
+	var errs config.ValidationError
+	if !errors.As(err, &errs) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(1)
+}
+
+func parseMode(s string) (interface{}, error) {
+	if _, ok := Modes[s]; !ok {
+		return nil, fmt.Errorf("unknown mode %q", s)
+	}
+	return s, nil
+}
+
+func optionalString(s string) (interface{}, error) {
+	return s, nil
+}
+
+func parseBool(s string) (interface{}, error) {
+	return strconv.ParseBool(s)
+}
@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type (
+	// broker is the Bridge's MQTT connection, for the Snapserver's state and commands.
+	broker struct {
+		client mqtt.Client
+
+		// messages are the received messages' handlers, called one at a time, in order, by handleMessages.
+		// They run outside of the MQTT client's own goroutines, so that they can publish and wait for it.
+		messages chan func()
+	}
+
+	// messageBroker is what the Bridge needs of its MQTT connection, so that tests can stand in for the broker.
+	messageBroker interface {
+		Publish(topic, payload string) error
+		Subscribe(topic string, f func(message)) error
+		Unsubscribe(topic string) error
+		Disconnect()
+	}
+
+	// brokerOptions configure the Bridge's MQTT connection.
+	brokerOptions struct {
+		Username  string
+		Password  string
+		ClientID  string
+		KeepAlive time.Duration
+		TLSConfig *tls.Config
+
+		// ConnectHandler is called whenever the connection is (re)established.
+		ConnectHandler func()
+		// DisconnectHandler is called whenever the connection is lost.
+		DisconnectHandler func(error)
+	}
+
+	// message is an MQTT message received by the Bridge.
+	message struct {
+		Topic   string
+		Payload string
+		// Retained is whether the broker retained the message, i.e. it predates the subscription.
+		Retained bool
+	}
+)
+
+const (
+	qos = 1
+	// messageQueueSize is how many received messages can wait to be handled before the MQTT client blocks.
+	messageQueueSize = 256
+)
+
+// newBroker returns a connection to the MQTT broker at brokerURI, which reconnects by itself until Disconnect is called.
+func newBroker(brokerURI string, o brokerOptions) *broker {
+	b := &broker{
+		messages: make(chan func(), messageQueueSize),
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(brokerURI)
+	opts.SetClientID(o.ClientID)
+	if o.Username != "" {
+		opts.SetUsername(o.Username)
+		opts.SetPassword(o.Password)
+	}
+	if o.KeepAlive > 0 {
+		opts.SetKeepAlive(o.KeepAlive)
+	}
+	if o.TLSConfig != nil {
+		opts.SetTLSConfig(o.TLSConfig)
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetMaxReconnectInterval(maxReconnectDelay)
+	if o.ConnectHandler != nil {
+		opts.SetOnConnectHandler(func(mqtt.Client) {
+			o.ConnectHandler()
+		})
+	}
+	if o.DisconnectHandler != nil {
+		opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			o.DisconnectHandler(err)
+		})
+	}
+	b.client = mqtt.NewClient(opts)
+
+	go b.handleMessages()
+	return b
+}
+
+// clientID returns the MQTT client ID for the named daemon.
+// A configured ID gets the name appended, so that daemons in different modes sharing a config don't take over each other's connections.
+func clientID(configured, name string) string {
+	if configured != "" {
+		return configured + "-" + name
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("catbus-snapcast-%s-%s-%d", name, hostname, os.Getpid())
+}
+
+// Connect connects to the broker, retrying until it succeeds.
+func (b *broker) Connect() error {
+	token := b.client.Connect()
+	token.Wait()
+	return token.Error()
+}
+
+// Disconnect disconnects from the broker, once any messages being published have been sent.
+func (b *broker) Disconnect() {
+	b.client.Disconnect(uint(timeout / time.Millisecond))
+}
+
+// Publish publishes a retained message.
+func (b *broker) Publish(topic, payload string) error {
+	return wait(b.client.Publish(topic, qos, true, payload))
+}
+
+// Subscribe calls f for each message on a topic, including any retained message.
+func (b *broker) Subscribe(topic string, f func(message)) error {
+	return wait(b.client.Subscribe(topic, qos, func(_ mqtt.Client, msg mqtt.Message) {
+		m := message{
+			Topic:    msg.Topic(),
+			Payload:  string(msg.Payload()),
+			Retained: msg.Retained(),
+		}
+		b.messages <- func() { f(m) }
+	}))
+}
+
+// Unsubscribe stops calling the handler for a topic.
+func (b *broker) Unsubscribe(topic string) error {
+	return wait(b.client.Unsubscribe(topic))
+}
+
+func (b *broker) handleMessages() {
+	for handle := range b.messages {
+		handle()
+	}
+}
+
+// wait waits for an MQTT operation to finish.
+func wait(token mqtt.Token) error {
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	return token.Error()
+}
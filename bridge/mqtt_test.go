@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClientID(t *testing.T) {
+	if got := clientID("snapcast", "actuator"); got != "snapcast-actuator" {
+		t.Errorf(`clientID("snapcast", "actuator") = %q, want "snapcast-actuator"`, got)
+	}
+	if actuator, observer := clientID("snapcast", "actuator"), clientID("snapcast", "observer"); actuator == observer {
+		t.Errorf("clientID() = %q for both the actuator and the observer, want distinct IDs", actuator)
+	}
+	if got := clientID("", "observer"); !strings.HasPrefix(got, "catbus-snapcast-observer-") {
+		t.Errorf(`clientID("", "observer") = %q, want a "catbus-snapcast-observer-" prefix`, got)
+	}
+}
@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/availability"
+	"go.eth.moe/catbus-snapcast/homeassistant"
+	"go.eth.moe/catbus-snapcast/scenes"
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+// speakerPosition is where a speaker is in the Bridge's copy of the groups.
+type speakerPosition struct {
+	groupID string
+	index   int
+}
+
+// observe publishes the Snapserver's current state for each group the Bridge controls, and keeps it up to date.
+// In actuate-only mode it only records the state with publishState, without publishing anything.
+func (b *Bridge) observe(snapserver snapcast.Client, streams []snapcast.Stream) {
+	observing := b.opts.Mode&Observe != 0
+
+	if observing {
+		if err := b.publish(b.availabilityTopic("snapserver"), availability.Online); err != nil {
+			log.Printf("could not publish Snapserver availability: %v", err)
+		}
+		if b.cfg().Topics.Scene != "" {
+			b.publishScenes()
+		}
+	}
+
+	streamNames := make([]string, len(streams))
+	for i, stream := range streams {
+		streamNames[i] = string(stream.ID)
+	}
+	sort.Strings(streamNames)
+
+	// The handlers keep these copies of the groups up to date.
+	// The volume handler is called for notifications, and for the Bridge's own changes by echoingClient, so it needs a lock.
+	var mu sync.Mutex
+	groups := map[string]snapcast.Group{}
+	speakers := map[string]speakerPosition{}
+
+	for _, group := range b.controlledGroups() {
+		if observing {
+			if err := b.publish(b.cfg().InputValuesTopic(group), strings.Join(streamNames, "\n")); err != nil {
+				log.Printf("could not publish group %v stream values: %v", group.ID, err)
+			}
+		}
+
+		if err := b.publishState(b.cfg().InputTopic(group), string(group.Stream)); err != nil {
+			log.Printf("could not publish group %v stream value %q: %v", group.ID, group.Stream, err)
+		} else if observing {
+			log.Printf("published group %v stream value %q", group.ID, group.Stream)
+		}
+
+		for i, speaker := range group.Speakers {
+			speakers[speaker.ID] = speakerPosition{groupID: group.ID, index: i}
+			b.publishSpeakerVolume(group, speaker, speaker.Volume)
+		}
+		b.publishGroupVolume(group)
+
+		if observing && b.cfg().HomeAssistant.DiscoveryPrefix != "" {
+			b.publishDiscovery(group, streams)
+		}
+
+		group.Speakers = append([]snapcast.Speaker{}, group.Speakers...)
+		groups[group.ID] = group
+	}
+
+	snapserver.SetSpeakerVolumeChangedHandler(func(speakerID string, volume snapcast.Volume) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		position, ok := speakers[speakerID]
+		if !ok {
+			return
+		}
+		group := groups[position.groupID]
+		group.Speakers[position.index].Volume = volume
+		b.publishSpeakerVolume(group, group.Speakers[position.index], volume)
+		b.settleGroupVolume(group)
+	})
+
+	snapserver.SetGroupStreamChangedHandler(func(groupID string, stream snapcast.StreamID) {
+		group, ok := groups[groupID]
+		if !ok {
+			return
+		}
+
+		log.Printf("publishing group %v stream value %q", groupID, stream)
+		if err := b.publishState(b.cfg().InputTopic(group), string(stream)); err != nil {
+			log.Printf("could not publish group %v stream value %q: %v", groupID, stream, err)
+		}
+	})
+}
+
+func (b *Bridge) publishGroupVolume(group snapcast.Group) {
+	if err := b.publishState(b.cfg().GroupVolumeTopic(group), strconv.Itoa(group.Volume())); err != nil {
+		log.Printf("could not publish group %v volume: %v", group.ID, err)
+	}
+}
+
+// settleGroupVolume publishes a group's volume once its speakers' volumes have settled for groupVolumeSettle.
+// A change to the whole group arrives as a change to each speaker, and the means in between are not volumes anyone set.
+func (b *Bridge) settleGroupVolume(group snapcast.Group) {
+	topic := b.cfg().GroupVolumeTopic(group)
+	payload := strconv.Itoa(group.Volume())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if timer, ok := b.groupVolumes[group.ID]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(groupVolumeSettle, func() {
+		b.mu.Lock()
+		current := b.groupVolumes[group.ID] == timer
+		if current {
+			delete(b.groupVolumes, group.ID)
+		}
+		b.mu.Unlock()
+		if !current {
+			return
+		}
+
+		if err := b.publishState(topic, payload); err != nil {
+			log.Printf("could not publish group %v volume: %v", group.ID, err)
+		}
+	})
+	b.groupVolumes[group.ID] = timer
+}
+
+func (b *Bridge) publishSpeakerVolume(group snapcast.Group, speaker snapcast.Speaker, volume snapcast.Volume) {
+	if err := b.publishState(b.cfg().SpeakerVolumeTopic(group, speaker), strconv.Itoa(volume.Percent)); err != nil {
+		log.Printf("could not publish speaker %v volume: %v", speaker.ID, err)
+	}
+	if err := b.publishState(b.cfg().SpeakerMuteTopic(group, speaker), strconv.FormatBool(volume.Muted)); err != nil {
+		log.Printf("could not publish speaker %v mute: %v", speaker.ID, err)
+	}
+}
+
+// publishScenes publishes the names of the saved scenes, newline-separated, as with the input values.
+func (b *Bridge) publishScenes() {
+	names, err := scenes.List(b.cfg().Scenes.Dir)
+	if err != nil {
+		log.Printf("could not list scenes: %v", err)
+		return
+	}
+	if err := b.publish(path.Join(b.cfg().Topics.Scene, "values"), strings.Join(names, "\n")); err != nil {
+		log.Printf("could not publish scene values: %v", err)
+	}
+}
+
+func (b *Bridge) publishDiscovery(group snapcast.Group, streams []snapcast.Stream) {
+	// The entities work when something is actuating, and something is observing.
+	availabilityTopics := []string{b.availabilityTopic(b.opts.Name)}
+	if b.opts.Mode != Both {
+		availabilityTopics = []string{b.availabilityTopic("actuator"), b.availabilityTopic("observer")}
+	}
+
+	msgs, err := homeassistant.Discovery(b.cfg().HomeAssistant.DiscoveryPrefix, group, streams, homeassistant.Topics{
+		Input:       b.cfg().InputTopic(group),
+		GroupVolume: b.cfg().GroupVolumeTopic(group),
+		SpeakerVolume: func(speaker snapcast.Speaker) string {
+			return b.cfg().SpeakerVolumeTopic(group, speaker)
+		},
+		SpeakerMute: func(speaker snapcast.Speaker) string {
+			return b.cfg().SpeakerMuteTopic(group, speaker)
+		},
+		Availability: availabilityTopics,
+	})
+	if err != nil {
+		log.Printf("could not build Home Assistant discovery: %v", err)
+		return
+	}
+	for _, msg := range msgs {
+		if err := b.publish(msg.Topic, msg.Payload); err != nil {
+			log.Printf("could not publish Home Assistant discovery to %v: %v", msg.Topic, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/config"
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+func TestSettleGroupVolume(t *testing.T) {
+	cfg, err := config.Load("", config.Overrides{
+		"mqttBroker":          "tcp://localhost:1883",
+		"topics.input":        "home/{group.name}/input",
+		"topics.availability": "home/availability",
+		"snapcast.groupId":    "g1",
+	})
+	if err != nil {
+		t.Fatalf("could not load config: %v", err)
+	}
+	b := New(cfg, Options{Mode: Actuate})
+
+	// Setting the group to 60 from 20 changes one speaker at a time.
+	group := snapcast.Group{
+		ID:   "g1",
+		Name: "kitchen",
+		Speakers: []snapcast.Speaker{
+			{ID: "s1", Volume: snapcast.Volume{Percent: 20}},
+			{ID: "s2", Volume: snapcast.Volume{Percent: 20}},
+		},
+	}
+	for i := range group.Speakers {
+		speakers := append([]snapcast.Speaker{}, group.Speakers...)
+		speakers[i].Volume.Percent = 60
+		group.Speakers = speakers
+		b.settleGroupVolume(group)
+	}
+	time.Sleep(3 * groupVolumeSettle)
+
+	topic := cfg.GroupVolumeTopic(group)
+	b.mu.Lock()
+	got := b.pending[topic]
+	b.mu.Unlock()
+	if want := []string{"60"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v to %v, want %v", got, topic, want)
+	}
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+// sleepTimer is a running sleep timer.
+type sleepTimer struct {
+	deadline time.Time
+	cancel   context.CancelFunc
+}
+
+// parseSleepTimer parses a sleep timer payload: whole minutes, e.g. "30", or a duration, e.g. "1h30m".
+func parseSleepTimer(payload string) (time.Duration, error) {
+	payload = strings.TrimSpace(payload)
+
+	if minutes, err := strconv.Atoi(payload); err == nil {
+		if minutes < 0 {
+			return 0, errors.New("must not be negative")
+		}
+		return time.Duration(minutes) * time.Minute, nil
+	}
+
+	d, err := time.ParseDuration(payload)
+	if err != nil {
+		return 0, fmt.Errorf("must be minutes or a duration: %w", err)
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return d, nil
+}
+
+// setSleepTimer starts, restarts, or with 0 cancels, a group's sleep timer.
+func (b *Bridge) setSleepTimer(groupID, payload string) {
+	d, err := parseSleepTimer(payload)
+	if err != nil {
+		log.Printf("invalid sleep timer %q for group %v: %v", payload, groupID, err)
+		return
+	}
+
+	b.mu.Lock()
+	if st, ok := b.sleepTimers[groupID]; ok {
+		st.cancel()
+		delete(b.sleepTimers, groupID)
+	}
+	var st *sleepTimer
+	var ctx context.Context
+	if d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(context.Background())
+		st = &sleepTimer{deadline: time.Now().Add(d), cancel: cancel}
+		b.sleepTimers[groupID] = st
+	}
+	b.mu.Unlock()
+
+	if st == nil {
+		log.Printf("cancelled group %v sleep timer", groupID)
+		b.publishSleepTimerRemaining(groupID)
+		return
+	}
+
+	log.Printf("group %v sleeping in %v", groupID, d)
+	go b.runSleepTimer(ctx, groupID, st)
+}
+
+// runSleepTimer publishes the time remaining every minute, then puts a group to sleep, unless ctx is cancelled first.
+func (b *Bridge) runSleepTimer(ctx context.Context, groupID string, st *sleepTimer) {
+	defer func() {
+		b.mu.Lock()
+		if b.sleepTimers[groupID] == st {
+			delete(b.sleepTimers, groupID)
+		}
+		b.mu.Unlock()
+		b.publishSleepTimerRemaining(groupID)
+	}()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(st.deadline))
+	defer timer.Stop()
+
+	for done := false; !done; {
+		b.publishSleepTimerRemaining(groupID)
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			done = true
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	b.sleep(ctx, groupID)
+}
+
+// sleep fades a group out, then mutes its speakers or switches it to the idle stream, and restores their volumes for next time.
+// If ctx is cancelled during the fade, the volumes are restored, and the group is left playing.
+// The fade replaces any running fade of the group or its speakers, and is itself a group fade,
+// so a volume command during it stops it, and leaves the group playing at the volumes it was given.
+func (b *Bridge) sleep(ctx context.Context, groupID string) {
+	b.mu.Lock()
+	snapserver := b.snapserver
+	b.mu.Unlock()
+	if snapserver == nil {
+		log.Print("could not sleep: not connected to Snapserver")
+		return
+	}
+
+	cfg := b.cfg()
+
+	gctx, cancel := context.WithTimeout(ctx, timeout)
+	groups, err := snapserver.Groups(gctx)
+	cancel()
+	if err != nil {
+		log.Printf("could not sleep: could not get groups: %v", err)
+		return
+	}
+	group, ok := groups[groupID]
+	if !ok {
+		log.Printf("could not sleep: could not find group %v", groupID)
+		return
+	}
+
+	key := groupFadeKey(groupID)
+	b.cancelFade(key)
+	for _, speaker := range group.Speakers {
+		b.cancelFade(speaker.ID)
+	}
+	fctx, cancelFade := context.WithCancel(ctx)
+	defer cancelFade()
+	fd := &fade{cancel: cancelFade}
+	b.mu.Lock()
+	b.fades[key] = fd
+	b.mu.Unlock()
+
+	log.Printf("fading group %v out over %v", groupID, cfg.SleepTimer.Fade)
+	fadeErr := snapcast.FadeGroup(fctx, snapserver, groupID, 0, cfg.SleepTimer.Fade, snapcast.Linear)
+
+	b.mu.Lock()
+	if b.fades[key] == fd {
+		delete(b.fades, key)
+	}
+	b.mu.Unlock()
+
+	if fadeErr != nil && fctx.Err() != nil && ctx.Err() == nil {
+		log.Printf("stopped fading group %v out for a volume change, staying awake", groupID)
+		return
+	}
+
+	// Use a fresh context, so that the group is restored even if the sleep timer was cancelled.
+	rctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if fadeErr == nil && cfg.SleepTimer.IdleStream != "" {
+		if err := snapserver.SetGroupStream(rctx, groupID, cfg.SleepTimer.IdleStream); err != nil {
+			log.Printf("could not switch group %v to idle stream %q: %v", groupID, cfg.SleepTimer.IdleStream, err)
+		}
+	}
+
+	for _, speaker := range group.Speakers {
+		volume := speaker.Volume
+		if fadeErr == nil && cfg.SleepTimer.IdleStream == "" {
+			volume.Muted = true
+		}
+		if err := snapserver.SetSpeakerVolume(rctx, speaker.ID, volume); err != nil {
+			log.Printf("could not restore speaker %v volume: %v", speaker.ID, err)
+		}
+	}
+
+	switch {
+	case errors.Is(fadeErr, context.Canceled):
+		log.Printf("cancelled group %v sleep timer while fading out", groupID)
+	case fadeErr != nil:
+		log.Printf("could not fade group %v out: %v", groupID, fadeErr)
+	default:
+		log.Printf("group %v slept", groupID)
+	}
+}
+
+// publishSleepTimerRemaining publishes the whole minutes left on a group's sleep timer, or 0 if there is none.
+func (b *Bridge) publishSleepTimerRemaining(groupID string) {
+	b.mu.Lock()
+	group, ok := b.groups[groupID]
+	remaining := time.Duration(0)
+	if st, running := b.sleepTimers[groupID]; running {
+		remaining = time.Until(st.deadline)
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	minutes := 0
+	if remaining > 0 {
+		minutes = int(math.Ceil(remaining.Minutes()))
+	}
+	if err := b.publish(b.cfg().SleepTimerRemainingTopic(group), strconv.Itoa(minutes)); err != nil {
+		log.Printf("could not publish group %v sleep timer: %v", groupID, err)
+	}
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSleepTimer(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    time.Duration
+		wantErr bool
+	}{
+		{payload: "30", want: 30 * time.Minute},
+		{payload: " 0 ", want: 0},
+		{payload: "1h30m", want: 90 * time.Minute},
+		{payload: "45s", want: 45 * time.Second},
+
+		{payload: "", wantErr: true},
+		{payload: "-5", wantErr: true},
+		{payload: "-5m", wantErr: true},
+		{payload: "soon", wantErr: true},
+		{payload: "1.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSleepTimer(tt.payload)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSleepTimer(%q) = %v, want error", tt.payload, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSleepTimer(%q) returned error: %v", tt.payload, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSleepTimer(%q) = %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// catbus-snapcast runs a Bridge in the mode chosen with -mode, by default in both directions.
+package main
+
+import "go.eth.moe/catbus-snapcast/bridge"
+
+func main() {
+	bridge.Main("")
+}
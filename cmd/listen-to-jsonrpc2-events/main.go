@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 
 	"go.eth.moe/catbus-snapcast/jsonrpc2"
 )
@@ -17,6 +18,8 @@ import (
 var (
 	host = flag.String("host", "", "host of Snapserver")
 	port = flag.Uint("port", 0, "port of Snapserver")
+
+	recordPath = flag.String("record", "", "path to write a JSONL recording of all messages to (optional)")
 )
 
 func main() {
@@ -32,6 +35,17 @@ func main() {
 	}
 	defer conn.Close()
 
+	if *recordPath != "" {
+		f, err := os.Create(*recordPath)
+		if err != nil {
+			log.Fatalf("could not create recording: %v", err)
+		}
+		defer f.Close()
+
+		conn = jsonrpc2.NewRecordingConn(conn, f)
+		log.Printf("recording to %v", *recordPath)
+	}
+
 	log.Print("connected")
 
 	client := jsonrpc2.NewClient(conn)
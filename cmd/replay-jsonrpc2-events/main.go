@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"go.eth.moe/catbus-snapcast/jsonrpc2"
+)
+
+var (
+	recordingPath = flag.String("recording", "", "path to a JSONL recording from listen-to-jsonrpc2-events")
+	port          = flag.Uint("port", 0, "port to listen on")
+	speed         = flag.Float64("speed", 1, "notification playback speed, or 0 to send every notification at once")
+)
+
+func main() {
+	flag.Parse()
+	if *recordingPath == "" || *port == 0 {
+		log.Fatal("must set -recording and -port")
+	}
+
+	f, err := os.Open(*recordingPath)
+	if err != nil {
+		log.Fatalf("could not open recording: %v", err)
+	}
+	records, err := jsonrpc2.ReadRecording(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("could not read recording: %v", err)
+	}
+
+	addr := fmt.Sprintf(":%v", *port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("could not listen on %v: %v", addr, err)
+	}
+	log.Printf("replaying %d records on %v", len(records), addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatalf("could not accept connection: %v", err)
+		}
+
+		go func() {
+			defer conn.Close()
+
+			log.Printf("replaying to %v", conn.RemoteAddr())
+			if err := jsonrpc2.Replay(context.Background(), conn, records, *speed); err != nil {
+				log.Printf("could not replay to %v: %v", conn.RemoteAddr(), err)
+				return
+			}
+			log.Printf("finished replaying to %v", conn.RemoteAddr())
+		}()
+	}
+}
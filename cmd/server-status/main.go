@@ -61,7 +61,8 @@ func main() {
 		fmt.Printf("  stream: %v\n", g.Stream)
 		fmt.Printf("  speakers:\n")
 		for _, c := range g.Speakers {
-			fmt.Printf("  - name: %v\n", c.Name)
+			fmt.Printf("  - id: %v\n", c.ID)
+			fmt.Printf("    name: %v\n", c.Name)
 			fmt.Printf("    connected: %v\n", c.Connected)
 			fmt.Printf("    muted: %v\n", c.Volume.Muted)
 			fmt.Printf("    volume: %v%%\n", c.Volume.Percent)
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// snapcast-scene saves and restores Snapserver scenes.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+
+	"go.eth.moe/catbus-snapcast/scenes"
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+var (
+	snapserverHost = flag.String("snapserver-host", "", "host of Snapserver (optional)")
+	snapserverPort = flag.Uint("snapserver-port", snapcast.DefaultPort, "port of Snapserver")
+
+	scenesDir = flag.String("scenes-dir", ".", "directory of scene files")
+
+	list    = flag.Bool("list", false, "list saved scenes")
+	save    = flag.String("save", "", "name of scene to save the current arrangement as")
+	restore = flag.String("restore", "", "name of scene to restore")
+)
+
+func main() {
+	flag.Parse()
+
+	if *list {
+		names, err := scenes.List(*scenesDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	if (*save == "") == (*restore == "") {
+		log.Fatal("must set one of -list, -save, or -restore")
+	}
+
+	var client snapcast.Client
+	if *snapserverHost != "" {
+		addr := fmt.Sprintf("%v:%v", *snapserverHost, *snapserverPort)
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			log.Fatalf("could not dial %v: %v", addr, err)
+		}
+		defer conn.Close()
+
+		client = snapcast.NewClient(conn)
+	} else {
+		var err error
+		client, err = snapcast.Discover()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Print("connected")
+
+	ctx := context.Background()
+
+	if *save != "" {
+		scene, err := scenes.Snapshot(ctx, client, *save)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := scenes.Save(*scenesDir, scene); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("saved scene %q", *save)
+		return
+	}
+
+	scene, err := scenes.Load(*scenesDir, *restore)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := scenes.Restore(ctx, client, scene); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("restored scene %q", *restore)
+}
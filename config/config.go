@@ -2,65 +2,524 @@
 //
 // SPDX-License-Identifier: MIT
 
+// Package config loads catbus-snapcast's config.
+//
+// Each setting can come from, in increasing order of precedence:
+// its default, the config file (JSON, YAML, or TOML, by extension), an environment variable, or a command-line flag.
+// See Fields for the names of each.
 package config
 
 import (
-	"encoding/json"
-	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
 )
 
 type (
 	Config struct {
 		BrokerURI string
 
+		MQTT struct {
+			Username string
+			Password string
+			// ClientID is the prefix of the MQTT client IDs, followed by the mode, e.g. "snapcast-actuator",
+			// or empty to use the mode, hostname, and process ID.
+			ClientID string
+			// KeepAlive is the MQTT keepalive interval, or 0 to use the client's default.
+			KeepAlive time.Duration
+
+			// CAFile is a PEM bundle of CAs to verify the broker with, instead of the system's.
+			CAFile string
+			// CertFile and KeyFile are a PEM client certificate and key to authenticate with.
+			CertFile string
+			KeyFile  string
+		}
+
+		// Topics may contain placeholders such as {group.name}, expanded against the live Snapcast model.
 		Topics struct {
-			Input       string
-			InputValues string
+			Input        string
+			InputValues  string
+			Availability string
+			Speakers     string
+			// GroupVolume is the topic for the group's volume, which scales its speakers' volumes proportionally.
+			GroupVolume string
+
+			SpeakerVolume string
+			SpeakerMute   string
+
+			// Scene is the topic to restore scenes by name from, or empty to not.
+			Scene string
+
+			// SleepTimer is the topic to set the group's sleep timer from, in minutes, with 0 to cancel it.
+			SleepTimer string
+			// SleepTimerRemaining is the topic for the whole minutes left on the group's sleep timer.
+			SleepTimerRemaining string
+
+			// Presence is the topic template for whether each group's room is occupied, for follow-me mode.
+			// It is expanded for every group on the Snapserver, so it must contain {group.id} or {group.name}.
+			Presence string
 		}
 
 		Snapcast struct {
+			// Address is the host:port of the Snapserver's JSON-RPC interface.
+			// If empty, the Snapserver is discovered with mDNS.
+			Address string
+			// GroupID is the group to control.
+			// If empty, every group is controlled, with its own topics, as long as topics.input contains a group placeholder.
 			GroupID string
 		}
+
+		HomeAssistant struct {
+			DiscoveryPrefix string
+		}
+
+		Scenes struct {
+			// Dir is the directory of scene files.
+			Dir string
+		}
+
+		SleepTimer struct {
+			// Fade is how long the group takes to fade out when the sleep timer ends.
+			Fade time.Duration
+			// IdleStream is the stream to switch the group to when the sleep timer ends.
+			// If empty, the group's speakers are muted instead.
+			IdleStream snapcast.StreamID
+		}
+
+		FollowMe struct {
+			// Stream is the stream that follows presence from group to group.
+			Stream snapcast.StreamID
+			// Debounce is how long presence must be stable before the stream moves.
+			Debounce time.Duration
+		}
 	}
 
+	// Overrides are setting values that take precedence over the config file, keyed by Field.Key.
+	Overrides map[string]string
+
+	// Field describes how a setting is named in each place it can be set.
+	Field struct {
+		// Key is the setting's path in the config file, e.g. "topics.input".
+		Key string
+		// Env is the environment variable to override the setting with.
+		Env string
+		// Flag is the command-line flag to override the setting with.
+		Flag string
+		// Usage describes the setting.
+		Usage string
+
+		value func(*config) *string
+	}
+
+	// config is the config as set, before defaults.
 	config struct {
-		MQTTBroker string `json:"mqttBroker"`
+		MQTTBroker string
+
+		MQTT struct {
+			Username     string
+			Password     string
+			PasswordFile string
+			ClientID     string
+			KeepAlive    string
+			CAFile       string
+			CertFile     string
+			KeyFile      string
+		}
 
 		Topics struct {
-			Input       string `json:"input"`
-			InputValues string `json:"inputValues"`
-		} `json:"topics"`
+			Input         string
+			InputValues   string
+			Availability  string
+			Speakers      string
+			GroupVolume   string
+			SpeakerVolume string
+			SpeakerMute   string
+			Scene         string
+
+			SleepTimer          string
+			SleepTimerRemaining string
+
+			Presence string
+		}
 
 		Snapcast struct {
-			GroupID string `json:"groupId"`
-		} `json:"snapcast"`
+			Address string
+			GroupID string
+		}
+
+		HomeAssistant struct {
+			DiscoveryPrefix string
+		}
+
+		Scenes struct {
+			Dir string
+		}
+
+		SleepTimer struct {
+			Fade       string
+			IdleStream string
+		}
+
+		FollowMe struct {
+			Stream   string
+			Debounce string
+		}
 	}
 )
 
+const (
+	defaultSleepTimerFade   = 30 * time.Second
+	defaultFollowMeDebounce = 10 * time.Second
+)
+
+// Fields are the settings that can be overridden, in the order they appear in the config file.
+var Fields = []Field{
+	{
+		Key:   "mqttBroker",
+		Env:   "CATBUS_SNAPCAST_MQTT_BROKER",
+		Flag:  "mqtt-broker",
+		Usage: "URI of the MQTT broker, e.g. tcp://localhost:1883",
+		value: func(c *config) *string { return &c.MQTTBroker },
+	},
+	{
+		Key:   "mqtt.username",
+		Env:   "CATBUS_SNAPCAST_MQTT_USERNAME",
+		Flag:  "mqtt-username",
+		Usage: "username to authenticate to the MQTT broker with",
+		value: func(c *config) *string { return &c.MQTT.Username },
+	},
+	{
+		Key:   "mqtt.password",
+		Env:   "CATBUS_SNAPCAST_MQTT_PASSWORD",
+		Flag:  "mqtt-password",
+		Usage: "password to authenticate to the MQTT broker with; prefer mqtt.passwordFile or the environment",
+		value: func(c *config) *string { return &c.MQTT.Password },
+	},
+	{
+		Key:   "mqtt.passwordFile",
+		Env:   "CATBUS_SNAPCAST_MQTT_PASSWORD_FILE",
+		Flag:  "mqtt-password-file",
+		Usage: "path to a file containing the password to authenticate to the MQTT broker with",
+		value: func(c *config) *string { return &c.MQTT.PasswordFile },
+	},
+	{
+		Key:   "mqtt.clientId",
+		Env:   "CATBUS_SNAPCAST_MQTT_CLIENT_ID",
+		Flag:  "mqtt-client-id",
+		Usage: "MQTT client ID prefix, followed by the mode, e.g. <mqtt.clientId>-actuator (default: the mode, hostname, and process ID)",
+		value: func(c *config) *string { return &c.MQTT.ClientID },
+	},
+	{
+		Key:   "mqtt.keepAlive",
+		Env:   "CATBUS_SNAPCAST_MQTT_KEEP_ALIVE",
+		Flag:  "mqtt-keep-alive",
+		Usage: "MQTT keepalive interval, e.g. 30s (default: chosen by the client)",
+		value: func(c *config) *string { return &c.MQTT.KeepAlive },
+	},
+	{
+		Key:   "mqtt.caFile",
+		Env:   "CATBUS_SNAPCAST_MQTT_CA_FILE",
+		Flag:  "mqtt-ca-file",
+		Usage: "path to a PEM bundle of CAs to verify the MQTT broker with (default: the system's)",
+		value: func(c *config) *string { return &c.MQTT.CAFile },
+	},
+	{
+		Key:   "mqtt.certFile",
+		Env:   "CATBUS_SNAPCAST_MQTT_CERT_FILE",
+		Flag:  "mqtt-cert-file",
+		Usage: "path to a PEM client certificate to authenticate to the MQTT broker with",
+		value: func(c *config) *string { return &c.MQTT.CertFile },
+	},
+	{
+		Key:   "mqtt.keyFile",
+		Env:   "CATBUS_SNAPCAST_MQTT_KEY_FILE",
+		Flag:  "mqtt-key-file",
+		Usage: "path to the PEM key for mqtt.certFile",
+		value: func(c *config) *string { return &c.MQTT.KeyFile },
+	},
+	{
+		Key:   "topics.input",
+		Env:   "CATBUS_SNAPCAST_TOPICS_INPUT",
+		Flag:  "topics-input",
+		Usage: "topic for the group's input, or with {group.id} or {group.name}, each group's",
+		value: func(c *config) *string { return &c.Topics.Input },
+	},
+	{
+		Key:   "topics.inputValues",
+		Env:   "CATBUS_SNAPCAST_TOPICS_INPUT_VALUES",
+		Flag:  "topics-input-values",
+		Usage: "topic for the group's possible inputs (default: <topics.input>/values)",
+		value: func(c *config) *string { return &c.Topics.InputValues },
+	},
+	{
+		Key:   "topics.availability",
+		Env:   "CATBUS_SNAPCAST_TOPICS_AVAILABILITY",
+		Flag:  "topics-availability",
+		Usage: "topic prefix for availability (default: <topics.input>/availability, or if topics.input has placeholders, its levels before them then availability)",
+		value: func(c *config) *string { return &c.Topics.Availability },
+	},
+	{
+		Key:   "topics.speakers",
+		Env:   "CATBUS_SNAPCAST_TOPICS_SPEAKERS",
+		Flag:  "topics-speakers",
+		Usage: "topic prefix for speakers (default: <topics.input>/speakers)",
+		value: func(c *config) *string { return &c.Topics.Speakers },
+	},
+	{
+		Key:   "topics.groupVolume",
+		Env:   "CATBUS_SNAPCAST_TOPICS_GROUP_VOLUME",
+		Flag:  "topics-group-volume",
+		Usage: "topic for the group's volume, scaling its speakers proportionally (default: <topics.input>/volume)",
+		value: func(c *config) *string { return &c.Topics.GroupVolume },
+	},
+	{
+		Key:   "topics.speakerVolume",
+		Env:   "CATBUS_SNAPCAST_TOPICS_SPEAKER_VOLUME",
+		Flag:  "topics-speaker-volume",
+		Usage: "topic template for each speaker's volume (default: <topics.speakers>/{speaker.id}/volume)",
+		value: func(c *config) *string { return &c.Topics.SpeakerVolume },
+	},
+	{
+		Key:   "topics.speakerMute",
+		Env:   "CATBUS_SNAPCAST_TOPICS_SPEAKER_MUTE",
+		Flag:  "topics-speaker-mute",
+		Usage: "topic template for whether each speaker is muted (default: <topics.speakers>/{speaker.id}/mute)",
+		value: func(c *config) *string { return &c.Topics.SpeakerMute },
+	},
+	{
+		Key:   "topics.scene",
+		Env:   "CATBUS_SNAPCAST_TOPICS_SCENE",
+		Flag:  "topics-scene",
+		Usage: "topic to restore scenes by name from (default: no scenes)",
+		value: func(c *config) *string { return &c.Topics.Scene },
+	},
+	{
+		Key:   "topics.sleepTimer",
+		Env:   "CATBUS_SNAPCAST_TOPICS_SLEEP_TIMER",
+		Flag:  "topics-sleep-timer",
+		Usage: "topic to set the group's sleep timer from, in minutes, with 0 to cancel it (default: <topics.input>/sleep)",
+		value: func(c *config) *string { return &c.Topics.SleepTimer },
+	},
+	{
+		Key:   "topics.sleepTimerRemaining",
+		Env:   "CATBUS_SNAPCAST_TOPICS_SLEEP_TIMER_REMAINING",
+		Flag:  "topics-sleep-timer-remaining",
+		Usage: "topic for the minutes left on the group's sleep timer (default: <topics.sleepTimer>/remaining)",
+		value: func(c *config) *string { return &c.Topics.SleepTimerRemaining },
+	},
+	{
+		Key:   "topics.presence",
+		Env:   "CATBUS_SNAPCAST_TOPICS_PRESENCE",
+		Flag:  "topics-presence",
+		Usage: "topic template for whether each group's room is occupied, for follow-me mode, e.g. home/{group.name}/occupied",
+		value: func(c *config) *string { return &c.Topics.Presence },
+	},
+	{
+		Key:   "snapcast.address",
+		Env:   "CATBUS_SNAPCAST_SNAPCAST_ADDRESS",
+		Flag:  "snapcast-address",
+		Usage: "host:port of the Snapserver's JSON-RPC interface (default: discover with mDNS)",
+		value: func(c *config) *string { return &c.Snapcast.Address },
+	},
+	{
+		Key:   "snapcast.groupId",
+		Env:   "CATBUS_SNAPCAST_SNAPCAST_GROUP_ID",
+		Flag:  "snapcast-group-id",
+		Usage: "ID of the Snapcast group to control (default: every group, if topics.input has a group placeholder; optional with topics.presence, for follow-me only)",
+		value: func(c *config) *string { return &c.Snapcast.GroupID },
+	},
+	{
+		Key:   "homeAssistant.discoveryPrefix",
+		Env:   "CATBUS_SNAPCAST_HOME_ASSISTANT_DISCOVERY_PREFIX",
+		Flag:  "home-assistant-discovery-prefix",
+		Usage: "Home Assistant MQTT discovery prefix, e.g. homeassistant (default: no discovery)",
+		value: func(c *config) *string { return &c.HomeAssistant.DiscoveryPrefix },
+	},
+	{
+		Key:   "scenes.dir",
+		Env:   "CATBUS_SNAPCAST_SCENES_DIR",
+		Flag:  "scenes-dir",
+		Usage: "directory of scene files, as saved by snapcast-scene",
+		value: func(c *config) *string { return &c.Scenes.Dir },
+	},
+	{
+		Key:   "sleepTimer.fade",
+		Env:   "CATBUS_SNAPCAST_SLEEP_TIMER_FADE",
+		Flag:  "sleep-timer-fade",
+		Usage: "how long the group takes to fade out when the sleep timer ends (default: 30s)",
+		value: func(c *config) *string { return &c.SleepTimer.Fade },
+	},
+	{
+		Key:   "sleepTimer.idleStream",
+		Env:   "CATBUS_SNAPCAST_SLEEP_TIMER_IDLE_STREAM",
+		Flag:  "sleep-timer-idle-stream",
+		Usage: "stream to switch the group to when the sleep timer ends (default: mute the group's speakers)",
+		value: func(c *config) *string { return &c.SleepTimer.IdleStream },
+	},
+	{
+		Key:   "followMe.stream",
+		Env:   "CATBUS_SNAPCAST_FOLLOW_ME_STREAM",
+		Flag:  "follow-me-stream",
+		Usage: "stream to move to whichever groups' rooms are occupied, in follow-me mode",
+		value: func(c *config) *string { return &c.FollowMe.Stream },
+	},
+	{
+		Key:   "followMe.debounce",
+		Env:   "CATBUS_SNAPCAST_FOLLOW_ME_DEBOUNCE",
+		Flag:  "follow-me-debounce",
+		Usage: "how long presence must be stable before the follow-me stream moves (default: 10s)",
+		value: func(c *config) *string { return &c.FollowMe.Debounce },
+	},
+}
+
 func ParseFile(path string) (*Config, error) {
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
+	return Load(path, nil)
+}
 
+// Load loads the config from the JSON, YAML, or TOML file at path, if path is set,
+// then applies any environment variables from Fields, then overrides.
+// If the result is invalid, it returns a ValidationError with every problem found.
+func Load(path string, overrides Overrides) (*Config, error) {
 	raw := config{}
-	if err := json.Unmarshal(bytes, &raw); err != nil {
-		return nil, err
+	var errs ValidationError
+
+	if path != "" {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := decodeFile(path, bytes)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, setFromFile(&raw, "", file)...)
+	}
+
+	for _, field := range Fields {
+		if v, ok := os.LookupEnv(field.Env); ok {
+			*field.value(&raw) = v
+		}
+	}
+
+	for key, v := range overrides {
+		field, ok := fieldByKey(key)
+		if !ok {
+			errs = append(errs, FieldError{Path: key, Message: "unknown key"})
+			continue
+		}
+		*field.value(&raw) = v
+	}
+
+	c, convErrs := configFromConfig(raw)
+	errs = append(errs, convErrs...)
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err.(ValidationError)...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// setFromFile sets raw from a decoded config file, returning an error for every unknown key or non-string setting.
+func setFromFile(raw *config, prefix string, file map[string]interface{}) ValidationError {
+	var errs ValidationError
+
+	keys := make([]string, 0, len(file))
+	for key := range file {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := file[key]
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if field, ok := fieldByKey(key); ok {
+			s, ok := value.(string)
+			if !ok {
+				errs = append(errs, FieldError{Path: key, Message: "must be a string"})
+				continue
+			}
+			*field.value(raw) = s
+			continue
+		}
+
+		if !isSection(key) {
+			errs = append(errs, FieldError{Path: key, Message: "unknown key"})
+			continue
+		}
+		section, ok := value.(map[string]interface{})
+		if !ok {
+			errs = append(errs, FieldError{Path: key, Message: "must be an object"})
+			continue
+		}
+		errs = append(errs, setFromFile(raw, key, section)...)
 	}
 
-	return configFromConfig(raw)
+	return errs
 }
 
-func configFromConfig(raw config) (*Config, error) {
+// isSection returns whether key is an object containing other keys, e.g. "topics".
+func isSection(key string) bool {
+	for _, field := range Fields {
+		if strings.HasPrefix(field.Key, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldByKey(key string) (Field, bool) {
+	for _, field := range Fields {
+		if field.Key == key {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// configFromConfig applies defaults to raw, and converts settings that are not strings in Config.
+func configFromConfig(raw config) (*Config, ValidationError) {
+	var errs ValidationError
+
 	c := &Config{
 		BrokerURI: raw.MQTTBroker,
 	}
 
-	if raw.Topics.Input == "" {
-		return nil, errors.New("must set topics.input")
+	c.MQTT.Username = raw.MQTT.Username
+	c.MQTT.Password = raw.MQTT.Password
+	if raw.MQTT.PasswordFile != "" {
+		if raw.MQTT.Password != "" {
+			errs = append(errs, FieldError{Path: "mqtt.passwordFile", Message: "must not be set with mqtt.password"})
+		}
+		password, err := ioutil.ReadFile(raw.MQTT.PasswordFile)
+		if err != nil {
+			errs = append(errs, FieldError{Path: "mqtt.passwordFile", Message: fmt.Sprintf("could not read: %v", err)})
+		}
+		c.MQTT.Password = strings.TrimRight(string(password), "\r\n")
+	}
+	c.MQTT.ClientID = raw.MQTT.ClientID
+	if raw.MQTT.KeepAlive != "" {
+		keepAlive, err := time.ParseDuration(raw.MQTT.KeepAlive)
+		if err != nil {
+			errs = append(errs, FieldError{Path: "mqtt.keepAlive", Message: "must be a duration, e.g. 30s"})
+		}
+		c.MQTT.KeepAlive = keepAlive
 	}
+	c.MQTT.CAFile = raw.MQTT.CAFile
+	c.MQTT.CertFile = raw.MQTT.CertFile
+	c.MQTT.KeyFile = raw.MQTT.KeyFile
+
 	c.Topics.Input = raw.Topics.Input
 
 	c.Topics.InputValues = raw.Topics.InputValues
@@ -68,10 +527,144 @@ func configFromConfig(raw config) (*Config, error) {
 		c.Topics.InputValues = path.Join(c.Topics.Input, "values")
 	}
 
-	if raw.Snapcast.GroupID == "" {
-		return nil, errors.New("must set snapcast.groupId")
+	c.Topics.Availability = raw.Topics.Availability
+	if c.Topics.Availability == "" {
+		c.Topics.Availability = path.Join(literalPrefix(c.Topics.Input), "availability")
+	}
+
+	c.Topics.Speakers = raw.Topics.Speakers
+	if c.Topics.Speakers == "" {
+		c.Topics.Speakers = path.Join(c.Topics.Input, "speakers")
 	}
+
+	c.Topics.GroupVolume = raw.Topics.GroupVolume
+	if c.Topics.GroupVolume == "" {
+		c.Topics.GroupVolume = path.Join(c.Topics.Input, "volume")
+	}
+
+	c.Topics.SpeakerVolume = raw.Topics.SpeakerVolume
+	if c.Topics.SpeakerVolume == "" {
+		c.Topics.SpeakerVolume = path.Join(c.Topics.Speakers, speakerID, "volume")
+	}
+
+	c.Topics.SpeakerMute = raw.Topics.SpeakerMute
+	if c.Topics.SpeakerMute == "" {
+		c.Topics.SpeakerMute = path.Join(c.Topics.Speakers, speakerID, "mute")
+	}
+
 	c.Snapcast.GroupID = raw.Snapcast.GroupID
 
-	return c, nil
+	c.Snapcast.Address = raw.Snapcast.Address
+
+	c.Topics.Scene = raw.Topics.Scene
+
+	c.Topics.SleepTimer = raw.Topics.SleepTimer
+	if c.Topics.SleepTimer == "" {
+		c.Topics.SleepTimer = path.Join(c.Topics.Input, "sleep")
+	}
+
+	c.Topics.SleepTimerRemaining = raw.Topics.SleepTimerRemaining
+	if c.Topics.SleepTimerRemaining == "" {
+		c.Topics.SleepTimerRemaining = path.Join(c.Topics.SleepTimer, "remaining")
+	}
+
+	c.HomeAssistant.DiscoveryPrefix = raw.HomeAssistant.DiscoveryPrefix
+
+	c.Scenes.Dir = raw.Scenes.Dir
+
+	c.SleepTimer.Fade = defaultSleepTimerFade
+	if raw.SleepTimer.Fade != "" {
+		fade, err := time.ParseDuration(raw.SleepTimer.Fade)
+		if err != nil {
+			errs = append(errs, FieldError{Path: "sleepTimer.fade", Message: "must be a duration, e.g. 30s"})
+		}
+		c.SleepTimer.Fade = fade
+	}
+	c.SleepTimer.IdleStream = snapcast.StreamID(raw.SleepTimer.IdleStream)
+
+	c.Topics.Presence = raw.Topics.Presence
+	c.FollowMe.Stream = snapcast.StreamID(raw.FollowMe.Stream)
+	c.FollowMe.Debounce = defaultFollowMeDebounce
+	if raw.FollowMe.Debounce != "" {
+		debounce, err := time.ParseDuration(raw.FollowMe.Debounce)
+		if err != nil {
+			errs = append(errs, FieldError{Path: "followMe.debounce", Message: "must be a duration, e.g. 10s"})
+		}
+		c.FollowMe.Debounce = debounce
+	}
+
+	return c, errs
+}
+
+// ControlsGroup returns whether the Bridge observes and actuates a group:
+// the configured group, or if none is, every group, as long as topics.input can give each its own topics.
+func (c *Config) ControlsGroup(group snapcast.Group) bool {
+	if c.Snapcast.GroupID != "" {
+		return group.ID == c.Snapcast.GroupID
+	}
+	return hasPlaceholder(c.Topics.Input, groupPlaceholders)
+}
+
+// InputTopic returns the topic for a group's stream.
+func (c *Config) InputTopic(group snapcast.Group) string {
+	return expand(c.Topics.Input, group, snapcast.Speaker{})
+}
+
+// InputValuesTopic returns the topic for a group's possible streams, newline-separated.
+func (c *Config) InputValuesTopic(group snapcast.Group) string {
+	return expand(c.Topics.InputValues, group, snapcast.Speaker{})
+}
+
+// SleepTimerTopic returns the topic to set a group's sleep timer from.
+func (c *Config) SleepTimerTopic(group snapcast.Group) string {
+	return expand(c.Topics.SleepTimer, group, snapcast.Speaker{})
+}
+
+// SleepTimerRemainingTopic returns the topic for the minutes left on a group's sleep timer.
+func (c *Config) SleepTimerRemainingTopic(group snapcast.Group) string {
+	return expand(c.Topics.SleepTimerRemaining, group, snapcast.Speaker{})
+}
+
+// PresenceTopic returns the topic for whether a group's room is occupied.
+func (c *Config) PresenceTopic(group snapcast.Group) string {
+	return expand(c.Topics.Presence, group, snapcast.Speaker{})
+}
+
+// GroupVolumeTopic returns the topic for a group's volume, as a percentage.
+func (c *Config) GroupVolumeTopic(group snapcast.Group) string {
+	return expand(c.Topics.GroupVolume, group, snapcast.Speaker{})
+}
+
+// SpeakerVolumeTopic returns the topic for a speaker's volume, as a percentage.
+func (c *Config) SpeakerVolumeTopic(group snapcast.Group, speaker snapcast.Speaker) string {
+	return expand(c.Topics.SpeakerVolume, group, speaker)
+}
+
+// SpeakerMuteTopic returns the topic for whether a speaker is muted, as "true" or "false".
+func (c *Config) SpeakerMuteTopic(group snapcast.Group, speaker snapcast.Speaker) string {
+	return expand(c.Topics.SpeakerMute, group, speaker)
+}
+
+// Diff returns the names of the fields that differ between c and other, such as "Topics.Input".
+func (c *Config) Diff(other *Config) []string {
+	return diff("", reflect.ValueOf(*c), reflect.ValueOf(*other))
+}
+
+func diff(prefix string, a, b reflect.Value) []string {
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return []string{prefix}
+		}
+		return nil
+	}
+
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		name := a.Type().Field(i).Name
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		changed = append(changed, diff(name, a.Field(i), b.Field(i))...)
+	}
+	return changed
 }
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// decoders decode a config file into nested maps, keyed by file extension.
+var decoders = map[string]func([]byte, *map[string]interface{}) error{
+	".json": func(data []byte, file *map[string]interface{}) error {
+		return json.Unmarshal(data, file)
+	},
+	".yaml": func(data []byte, file *map[string]interface{}) error {
+		return yaml.Unmarshal(data, file)
+	},
+	".yml": func(data []byte, file *map[string]interface{}) error {
+		return yaml.Unmarshal(data, file)
+	},
+	".toml": func(data []byte, file *map[string]interface{}) error {
+		return toml.Unmarshal(data, file)
+	},
+}
+
+// decodeFile decodes a JSON, YAML, or TOML config file, chosen by path's extension.
+func decodeFile(path string, data []byte) (map[string]interface{}, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	decode, ok := decoders[ext]
+	if !ok {
+		return nil, fmt.Errorf("unknown config file extension %q, must be .json, .yaml, .yml, or .toml", ext)
+	}
+
+	file := map[string]interface{}{}
+	if err := decode(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+)
+
+// BrokerAddress returns BrokerURI without any credentials, to be safe to log.
+func (c *Config) BrokerAddress() string {
+	u, err := url.Parse(c.BrokerURI)
+	if err != nil {
+		return "<invalid broker URI>"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// TLSConfig returns the TLS config for the MQTT broker, or nil if none of the TLS settings are set.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if c.MQTT.CAFile == "" && c.MQTT.CertFile == "" && c.MQTT.KeyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if c.MQTT.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.MQTT.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("could not find any certificates in CA file")
+		}
+	}
+
+	if c.MQTT.CertFile != "" || c.MQTT.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.MQTT.CertFile, c.MQTT.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
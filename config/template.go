@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+// Topics can be templates, with placeholders expanded against the live Snapcast model,
+// e.g. "home/{group.name}/speakers/{speaker.name}/volume".
+//
+// IDs are used as-is, and names are lowercased with runs of other characters replaced by "-",
+// so a group named "Living Room" becomes "living-room".
+// Group placeholders can be used in all group and speaker topics, and speaker placeholders only in speaker topics.
+const (
+	groupID     = "{group.id}"
+	groupName   = "{group.name}"
+	speakerID   = "{speaker.id}"
+	speakerName = "{speaker.name}"
+)
+
+var (
+	groupPlaceholders   = []string{groupID, groupName}
+	speakerPlaceholders = []string{groupID, groupName, speakerID, speakerName}
+
+	placeholderRegexp = regexp.MustCompile(`\{[^}]*\}`)
+	notSlugRegexp     = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// expand fills in a topic template's placeholders.
+func expand(template string, group snapcast.Group, speaker snapcast.Speaker) string {
+	return strings.NewReplacer(
+		groupID, group.ID,
+		groupName, slug(group.Name, group.ID),
+		speakerID, speaker.ID,
+		speakerName, slug(speaker.Name, speaker.ID),
+	).Replace(template)
+}
+
+// slug makes a name safe to use as a topic level, falling back to id if the name is empty.
+func slug(name, id string) string {
+	s := strings.Trim(notSlugRegexp.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if s == "" {
+		return id
+	}
+	return s
+}
+
+// literalPrefix returns the topic levels of a template before its first placeholder, or the whole topic if it has none.
+// If the first level has a placeholder, it returns "snapcast", so that topics derived from it have a root of their own.
+func literalPrefix(template string) string {
+	levels := strings.Split(template, "/")
+	for i, level := range levels {
+		if placeholderRegexp.MatchString(level) {
+			if i == 0 {
+				return "snapcast"
+			}
+			return strings.Join(levels[:i], "/")
+		}
+	}
+	return template
+}
+
+// hasPlaceholder returns whether a template contains any of the placeholders.
+func hasPlaceholder(template string, placeholders []string) bool {
+	for _, placeholder := range placeholders {
+		if strings.Contains(template, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// Disambiguate returns the groups, renamed where needed so that no two groups or speakers expand to the same topic,
+// and a description of each collision it found.
+// The name of a group or speaker that collides with another has its ID appended,
+// so two speakers named "Kitchen" become e.g. "kitchen-b8-27-eb-00-00-01" and "kitchen-b8-27-eb-00-00-02".
+// Only the topics of the groups the Bridge controls, and the presence topics of every group, are considered.
+func (c *Config) Disambiguate(groups map[string]snapcast.Group) (map[string]snapcast.Group, []string) {
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	groupTopics := map[string][]string{}
+	for _, id := range ids {
+		group := groups[id]
+		if c.ControlsGroup(group) {
+			groupTopics[id] = append(groupTopics[id],
+				c.InputTopic(group), c.InputValuesTopic(group), c.GroupVolumeTopic(group), c.SleepTimerTopic(group), c.SleepTimerRemainingTopic(group))
+		}
+		if c.Topics.Presence != "" {
+			groupTopics[id] = append(groupTopics[id], c.PresenceTopic(group))
+		}
+	}
+	collidingGroups, problems := collisions("groups", ids, groupTopics)
+
+	var speakerIDs []string
+	speakerTopics := map[string][]string{}
+	renamed := map[string]snapcast.Group{}
+	for _, id := range ids {
+		group := groups[id]
+		if collidingGroups[id] {
+			group.Name = strings.TrimSpace(group.Name + " " + group.ID)
+		}
+		renamed[id] = group
+
+		if !c.ControlsGroup(group) {
+			continue
+		}
+		for _, speaker := range group.Speakers {
+			speakerIDs = append(speakerIDs, speaker.ID)
+			speakerTopics[speaker.ID] = []string{c.SpeakerVolumeTopic(group, speaker), c.SpeakerMuteTopic(group, speaker)}
+		}
+	}
+	collidingSpeakers, speakerProblems := collisions("speakers", speakerIDs, speakerTopics)
+	problems = append(problems, speakerProblems...)
+
+	for id, group := range renamed {
+		speakers := make([]snapcast.Speaker, len(group.Speakers))
+		for i, speaker := range group.Speakers {
+			if collidingSpeakers[speaker.ID] {
+				speaker.Name = strings.TrimSpace(speaker.Name + " " + speaker.ID)
+			}
+			speakers[i] = speaker
+		}
+		group.Speakers = speakers
+		renamed[id] = group
+	}
+
+	return renamed, problems
+}
+
+// collisions returns the IDs that share a topic with another ID, and a description of each shared topic.
+func collisions(kind string, ids []string, topics map[string][]string) (map[string]bool, []string) {
+	owners := map[string][]string{}
+	var shared []string
+	for _, id := range ids {
+		seen := map[string]bool{}
+		for _, topic := range topics[id] {
+			if seen[topic] {
+				continue
+			}
+			seen[topic] = true
+			if len(owners[topic]) == 1 {
+				shared = append(shared, topic)
+			}
+			owners[topic] = append(owners[topic], id)
+		}
+	}
+
+	// Report each set of colliding IDs once, with the first topic they share.
+	colliding := map[string]bool{}
+	reported := map[string]bool{}
+	var problems []string
+	for _, topic := range shared {
+		for _, id := range owners[topic] {
+			colliding[id] = true
+		}
+		names := strings.Join(owners[topic], ", ")
+		if !reported[names] {
+			reported[names] = true
+			problems = append(problems, fmt.Sprintf("%s %s share topic %s, so their IDs are appended to their names", kind, names, topic))
+		}
+	}
+	return colliding, problems
+}
+
+// checkTemplate returns what is wrong with a topic template, if anything.
+func checkTemplate(template string, placeholders []string) string {
+	for _, placeholder := range placeholderRegexp.FindAllString(template, -1) {
+		if !contains(placeholders, placeholder) {
+			if len(placeholders) == 0 {
+				return fmt.Sprintf("must not contain placeholders, but has %s", placeholder)
+			}
+			return fmt.Sprintf("unknown placeholder %s, must be one of %s", placeholder, strings.Join(placeholders, ", "))
+		}
+	}
+
+	example := expand(template, snapcast.Group{ID: "group"}, snapcast.Speaker{ID: "speaker"})
+	return checkTopic(example)
+}
+
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
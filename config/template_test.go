@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+func TestExpand(t *testing.T) {
+	group := snapcast.Group{ID: "3f2a", Name: "Living Room"}
+	speaker := snapcast.Speaker{ID: "b8:27:eb:00:00:01", Name: "Sonos (left)"}
+
+	tests := []struct {
+		template string
+		group    snapcast.Group
+		speaker  snapcast.Speaker
+		want     string
+	}{
+		{"home/input", group, speaker, "home/input"},
+		{"home/{group.id}/input", group, speaker, "home/3f2a/input"},
+		{"home/{group.name}/input", group, speaker, "home/living-room/input"},
+		{"home/{group.name}/{speaker.name}/volume", group, speaker, "home/living-room/sonos-left/volume"},
+		{"home/{speaker.id}/volume", group, speaker, "home/b8:27:eb:00:00:01/volume"},
+		{"home/{group.name}/input", snapcast.Group{ID: "3f2a"}, speaker, "home/3f2a/input"},
+		{"home/{group.name}/input", snapcast.Group{ID: "3f2a", Name: "!!!"}, speaker, "home/3f2a/input"},
+	}
+	for _, tt := range tests {
+		if got := expand(tt.template, tt.group, tt.speaker); got != tt.want {
+			t.Errorf("expand(%q, %+v, %+v) = %q, want %q", tt.template, tt.group, tt.speaker, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	tests := []struct {
+		template     string
+		placeholders []string
+		wantProblem  bool
+	}{
+		{"home/input", nil, false},
+		{"home/{group.name}/input", groupPlaceholders, false},
+		{"home/{group.name}/{speaker.id}/volume", speakerPlaceholders, false},
+		{"home/{group.name}/input", nil, true},
+		{"home/{speaker.id}/volume", groupPlaceholders, true},
+		{"home/{speaker.colour}/volume", speakerPlaceholders, true},
+		{"home/#", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		problem := checkTemplate(tt.template, tt.placeholders)
+		if (problem != "") != tt.wantProblem {
+			t.Errorf("checkTemplate(%q, %v) = %q, want problem: %v", tt.template, tt.placeholders, problem, tt.wantProblem)
+		}
+	}
+}
+
+func TestDisambiguate(t *testing.T) {
+	c, err := Load("", Overrides{
+		"mqttBroker":           "tcp://localhost:1883",
+		"topics.input":         "home/{group.name}/input",
+		"topics.speakerVolume": "home/{group.name}/{speaker.name}/volume",
+		"topics.speakerMute":   "home/{group.name}/{speaker.name}/mute",
+	})
+	if err != nil {
+		t.Fatalf("could not load config: %v", err)
+	}
+
+	groups := map[string]snapcast.Group{
+		"g1": {ID: "g1", Name: "Kitchen", Speakers: []snapcast.Speaker{{ID: "s1", Name: "Shelf"}, {ID: "s2", Name: "shelf!"}}},
+		"g2": {ID: "g2", Name: "kitchen", Speakers: []snapcast.Speaker{{ID: "s3", Name: "Shelf"}}},
+		"g3": {ID: "g3", Name: "Hall", Speakers: []snapcast.Speaker{{ID: "s4", Name: "Shelf"}}},
+	}
+	got, problems := c.Disambiguate(groups)
+
+	want := map[string]snapcast.Group{
+		"g1": {ID: "g1", Name: "Kitchen g1", Speakers: []snapcast.Speaker{{ID: "s1", Name: "Shelf s1"}, {ID: "s2", Name: "shelf! s2"}}},
+		"g2": {ID: "g2", Name: "kitchen g2", Speakers: []snapcast.Speaker{{ID: "s3", Name: "Shelf"}}},
+		"g3": {ID: "g3", Name: "Hall", Speakers: []snapcast.Speaker{{ID: "s4", Name: "Shelf"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Disambiguate() = %+v, want %+v", got, want)
+	}
+	wantProblems := []string{
+		"groups g1, g2 share topic home/kitchen/input, so their IDs are appended to their names",
+		"speakers s1, s2 share topic home/kitchen-g1/shelf/volume, so their IDs are appended to their names",
+	}
+	if !reflect.DeepEqual(problems, wantProblems) {
+		t.Errorf("Disambiguate() found problems %q, want %q", problems, wantProblems)
+	}
+	if groups["g1"].Name != "Kitchen" || groups["g1"].Speakers[0].Name != "Shelf" {
+		t.Error("Disambiguate() modified its argument")
+	}
+
+	// With one group configured, the others' topics don't matter.
+	c.Snapcast.GroupID = "g1"
+	if _, problems := c.Disambiguate(groups); len(problems) != 1 {
+		t.Errorf("Disambiguate() for group g1 found problems %q, want only the speakers'", problems)
+	}
+}
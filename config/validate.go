@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// FieldError is a problem with one setting, named by its path in the config file.
+	FieldError struct {
+		Path    string
+		Message string
+	}
+
+	// ValidationError holds every problem found with a config.
+	ValidationError []FieldError
+)
+
+// brokerSchemes are the MQTT broker URI schemes supported by the MQTT client.
+var brokerSchemes = map[string]bool{
+	"tcp": true,
+	"ssl": true,
+	"tls": true,
+	"ws":  true,
+	"wss": true,
+}
+
+// maxTopicLength is the longest an MQTT topic name can be, in bytes.
+const maxTopicLength = 65535
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+func (e ValidationError) Error() string {
+	problems := make([]string, len(e))
+	for i, err := range e {
+		problems[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(problems, "; "))
+}
+
+// Validate checks every setting, returning a ValidationError listing all the problems found.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	check := func(key, message string) {
+		if message != "" {
+			errs = append(errs, FieldError{Path: key, Message: message})
+		}
+	}
+
+	check("mqttBroker", checkBrokerURI(c.BrokerURI))
+	if c.MQTT.Password != "" && c.MQTT.Username == "" {
+		check("mqtt.username", "must be set with a password")
+	}
+	if (c.MQTT.CertFile == "") != (c.MQTT.KeyFile == "") {
+		check("mqtt.certFile", "must be set with mqtt.keyFile")
+	} else if c.MQTT.CAFile != "" || c.MQTT.CertFile != "" {
+		if _, err := c.TLSConfig(); err != nil {
+			check("mqtt", err.Error())
+		}
+	}
+	if c.MQTT.KeepAlive < 0 {
+		check("mqtt.keepAlive", "must not be negative")
+	}
+
+	inputProblem := checkTemplate(c.Topics.Input, groupPlaceholders)
+	check("topics.input", inputProblem)
+	// Only check the derived topics if they were set or topics.input is valid, to not repeat problems with topics.input.
+	if inputProblem == "" || c.Topics.InputValues != path.Join(c.Topics.Input, "values") {
+		check("topics.inputValues", checkTemplate(c.Topics.InputValues, groupPlaceholders))
+	}
+	if inputProblem == "" || c.Topics.Availability != path.Join(literalPrefix(c.Topics.Input), "availability") {
+		check("topics.availability", checkTemplate(c.Topics.Availability, nil))
+	}
+	if inputProblem == "" || c.Topics.GroupVolume != path.Join(c.Topics.Input, "volume") {
+		check("topics.groupVolume", checkTemplate(c.Topics.GroupVolume, groupPlaceholders))
+	}
+	sleepTimerProblem := inputProblem
+	if inputProblem == "" || c.Topics.SleepTimer != path.Join(c.Topics.Input, "sleep") {
+		sleepTimerProblem = checkTemplate(c.Topics.SleepTimer, groupPlaceholders)
+		check("topics.sleepTimer", sleepTimerProblem)
+	}
+	if sleepTimerProblem == "" || c.Topics.SleepTimerRemaining != path.Join(c.Topics.SleepTimer, "remaining") {
+		check("topics.sleepTimerRemaining", checkTemplate(c.Topics.SleepTimerRemaining, groupPlaceholders))
+	}
+	if c.SleepTimer.Fade < 0 {
+		check("sleepTimer.fade", "must not be negative")
+	}
+	speakersProblem := inputProblem
+	if inputProblem == "" || c.Topics.Speakers != path.Join(c.Topics.Input, "speakers") {
+		speakersProblem = checkTemplate(c.Topics.Speakers, groupPlaceholders)
+		check("topics.speakers", speakersProblem)
+	}
+	if speakersProblem == "" || c.Topics.SpeakerVolume != path.Join(c.Topics.Speakers, speakerID, "volume") {
+		check("topics.speakerVolume", checkTemplate(c.Topics.SpeakerVolume, speakerPlaceholders))
+	}
+	if speakersProblem == "" || c.Topics.SpeakerMute != path.Join(c.Topics.Speakers, speakerID, "mute") {
+		check("topics.speakerMute", checkTemplate(c.Topics.SpeakerMute, speakerPlaceholders))
+	}
+
+	if c.Topics.Scene != "" {
+		check("topics.scene", checkTemplate(c.Topics.Scene, nil))
+		if c.Scenes.Dir == "" {
+			check("scenes.dir", "must be set with topics.scene")
+		}
+	}
+
+	if c.Topics.Presence != "" {
+		problem := checkTemplate(c.Topics.Presence, groupPlaceholders)
+		if problem == "" && !strings.Contains(c.Topics.Presence, groupID) && !strings.Contains(c.Topics.Presence, groupName) {
+			problem = fmt.Sprintf("must contain %s or %s", groupID, groupName)
+		}
+		check("topics.presence", problem)
+		if c.FollowMe.Stream == "" {
+			check("followMe.stream", "must be set with topics.presence")
+		}
+	}
+	if c.FollowMe.Debounce < 0 {
+		check("followMe.debounce", "must not be negative")
+	}
+
+	if c.Snapcast.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Snapcast.Address); err != nil {
+			check("snapcast.address", "must be host:port")
+		}
+	}
+	// Without a group, every group is controlled, so each needs topics of its own.
+	// Follow-me works across every group, so needs no particular one either.
+	everyGroup := hasPlaceholder(c.Topics.Input, groupPlaceholders)
+	if c.Snapcast.GroupID == "" && !everyGroup && c.Topics.Presence == "" {
+		check("snapcast.groupId", "must be set, unless topics.input contains {group.id} or {group.name}, or topics.presence is set")
+	}
+	if c.Snapcast.GroupID == "" && everyGroup {
+		for _, topic := range []struct {
+			key, template string
+			placeholders  []string
+		}{
+			{"topics.inputValues", c.Topics.InputValues, groupPlaceholders},
+			{"topics.groupVolume", c.Topics.GroupVolume, groupPlaceholders},
+			{"topics.sleepTimer", c.Topics.SleepTimer, groupPlaceholders},
+			{"topics.sleepTimerRemaining", c.Topics.SleepTimerRemaining, groupPlaceholders},
+			{"topics.speakerVolume", c.Topics.SpeakerVolume, speakerPlaceholders},
+			{"topics.speakerMute", c.Topics.SpeakerMute, speakerPlaceholders},
+		} {
+			if !hasPlaceholder(topic.template, topic.placeholders) {
+				check(topic.key, fmt.Sprintf("must contain one of %s when snapcast.groupId is not set, so that each group has its own", strings.Join(topic.placeholders, ", ")))
+			}
+		}
+	}
+
+	if c.HomeAssistant.DiscoveryPrefix != "" {
+		check("homeAssistant.discoveryPrefix", checkTemplate(c.HomeAssistant.DiscoveryPrefix, nil))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkBrokerURI returns what is wrong with an MQTT broker URI, if anything.
+func checkBrokerURI(uri string) string {
+	if uri == "" {
+		return "must be set"
+	}
+	// Don't include the parse error, as it repeats the URI, which may contain a password.
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "must be a URI"
+	}
+	if !brokerSchemes[u.Scheme] {
+		return fmt.Sprintf("must have scheme tcp, ssl, tls, ws, or wss, not %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "must have a host"
+	}
+	return ""
+}
+
+// checkTopic returns what is wrong with an MQTT topic name to publish to, if anything.
+func checkTopic(topic string) string {
+	switch {
+	case topic == "":
+		return "must be set"
+	case len(topic) > maxTopicLength:
+		return fmt.Sprintf("must be at most %d bytes", maxTopicLength)
+	case !utf8.ValidString(topic):
+		return "must be valid UTF-8"
+	case strings.ContainsAny(topic, "+#"):
+		return "must not contain wildcards + or #"
+	case strings.ContainsRune(topic, 0):
+		return "must not contain NUL"
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// minimal are the overrides for a minimal valid config.
+var minimal = Overrides{
+	"mqttBroker":          "tcp://localhost:1883",
+	"topics.input":        "home/{group.name}/input",
+	"topics.availability": "home/availability",
+	"snapcast.groupId":    "group",
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := Load("", minimal)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	got := map[string]string{
+		"InputValues":         c.Topics.InputValues,
+		"Speakers":            c.Topics.Speakers,
+		"GroupVolume":         c.Topics.GroupVolume,
+		"SpeakerVolume":       c.Topics.SpeakerVolume,
+		"SpeakerMute":         c.Topics.SpeakerMute,
+		"SleepTimer":          c.Topics.SleepTimer,
+		"SleepTimerRemaining": c.Topics.SleepTimerRemaining,
+	}
+	want := map[string]string{
+		"InputValues":         "home/{group.name}/input/values",
+		"Speakers":            "home/{group.name}/input/speakers",
+		"GroupVolume":         "home/{group.name}/input/volume",
+		"SpeakerVolume":       "home/{group.name}/input/speakers/{speaker.id}/volume",
+		"SpeakerMute":         "home/{group.name}/input/speakers/{speaker.id}/mute",
+		"SleepTimer":          "home/{group.name}/input/sleep",
+		"SleepTimerRemaining": "home/{group.name}/input/sleep/remaining",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() set topics %v, want %v", got, want)
+	}
+	if c.SleepTimer.Fade != defaultSleepTimerFade {
+		t.Errorf("Load() set sleepTimer.fade %v, want %v", c.SleepTimer.Fade, defaultSleepTimerFade)
+	}
+}
+
+func TestLoadDefaultAvailability(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "home/kitchen/input", want: "home/kitchen/input/availability"},
+		{input: "home/{group.name}/input", want: "home/availability"},
+		{input: "{group.id}/input", want: "snapcast/availability"},
+	}
+	for _, tt := range tests {
+		c, err := Load("", Overrides{
+			"mqttBroker":       "tcp://localhost:1883",
+			"topics.input":     tt.input,
+			"snapcast.groupId": "group",
+		})
+		if err != nil {
+			t.Errorf("Load() with topics.input %q returned error: %v", tt.input, err)
+			continue
+		}
+		if c.Topics.Availability != tt.want {
+			t.Errorf("Load() with topics.input %q set topics.availability %q, want %q", tt.input, c.Topics.Availability, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides Overrides
+		want      []string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "every setting missing",
+			overrides: Overrides{
+				"mqttBroker":          "",
+				"topics.input":        "",
+				"topics.availability": "",
+				"snapcast.groupId":    "",
+			},
+			// Topics derived from topics.input are not checked, so as not to repeat its problem.
+			want: []string{"mqttBroker", "topics.input", "snapcast.groupId"},
+		},
+		{
+			name:      "broker without host",
+			overrides: Overrides{"mqttBroker": "tcp://"},
+			want:      []string{"mqttBroker"},
+		},
+		{
+			name:      "broker with unknown scheme",
+			overrides: Overrides{"mqttBroker": "http://localhost"},
+			want:      []string{"mqttBroker"},
+		},
+		{
+			name:      "password without username",
+			overrides: Overrides{"mqtt.password": "hunter2"},
+			want:      []string{"mqtt.username"},
+		},
+		{
+			name:      "certificate without key",
+			overrides: Overrides{"mqtt.certFile": "client.pem"},
+			want:      []string{"mqtt.certFile"},
+		},
+		{
+			name:      "keepalive not a duration",
+			overrides: Overrides{"mqtt.keepAlive": "soon"},
+			want:      []string{"mqtt.keepAlive"},
+		},
+		{
+			name:      "wildcard topic",
+			overrides: Overrides{"topics.input": "home/+/input"},
+			want:      []string{"topics.input"},
+		},
+		{
+			name:      "wildcard topic before a placeholder",
+			overrides: Overrides{"topics.input": "home/+/{group.name}/input", "topics.availability": ""},
+			want:      []string{"topics.input"},
+		},
+		{
+			name:      "speaker placeholder in a group topic",
+			overrides: Overrides{"topics.groupVolume": "home/{speaker.id}/volume"},
+			want:      []string{"topics.groupVolume"},
+		},
+		{
+			name:      "unknown placeholder",
+			overrides: Overrides{"topics.speakerVolume": "home/{speaker.colour}/volume"},
+			want:      []string{"topics.speakerVolume"},
+		},
+		{
+			name:      "scene without a directory",
+			overrides: Overrides{"topics.scene": "home/scene"},
+			want:      []string{"scenes.dir"},
+		},
+		{
+			name:      "negative sleep timer fade",
+			overrides: Overrides{"sleepTimer.fade": "-1s"},
+			want:      []string{"sleepTimer.fade"},
+		},
+		{
+			name:      "presence without a group placeholder",
+			overrides: Overrides{"topics.presence": "home/occupied", "followMe.stream": "radio"},
+			want:      []string{"topics.presence"},
+		},
+		{
+			name:      "presence without a stream",
+			overrides: Overrides{"topics.presence": "home/{group.name}/occupied"},
+			want:      []string{"followMe.stream"},
+		},
+		{
+			name:      "every group",
+			overrides: Overrides{"snapcast.groupId": ""},
+		},
+		{
+			name:      "every group sharing a topic",
+			overrides: Overrides{"snapcast.groupId": "", "topics.groupVolume": "home/volume"},
+			want:      []string{"topics.groupVolume"},
+		},
+		{
+			name:      "every group without a group placeholder",
+			overrides: Overrides{"snapcast.groupId": "", "topics.input": "home/input"},
+			want:      []string{"snapcast.groupId"},
+		},
+		{
+			name: "follow-me without a group",
+			overrides: Overrides{
+				"snapcast.groupId": "",
+				"topics.presence":  "home/{group.name}/occupied",
+				"followMe.stream":  "radio",
+			},
+		},
+		{
+			name:      "snapcast address without port",
+			overrides: Overrides{"snapcast.address": "localhost"},
+			want:      []string{"snapcast.address"},
+		},
+		{
+			name:      "unknown key",
+			overrides: Overrides{"topics.inptu": "home/input"},
+			want:      []string{"topics.inptu"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides := Overrides{}
+			for k, v := range minimal {
+				overrides[k] = v
+			}
+			for k, v := range tt.overrides {
+				overrides[k] = v
+			}
+
+			_, err := Load("", overrides)
+
+			var got []string
+			var errs ValidationError
+			if errors.As(err, &errs) {
+				for _, err := range errs {
+					got = append(got, err.Path)
+				}
+			} else if err != nil {
+				t.Fatalf("Load() returned %v, want ValidationError", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() found problems with %v, want %v: %v", got, tt.want, err)
+			}
+		})
+	}
+}
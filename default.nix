@@ -10,7 +10,8 @@ buildGoModule rec {
   version = "latest";
   goPackagePath = "go.eth.moe/catbus-snapcast";
 
-  modSha256 = "0s31r2ccf5n53l0qpg8z94rbjb1aakkkkzhc6hh32ggmnp8blmsl";
+  # Whenever go.sum changes, set this to the hash nix-build reports.
+  modSha256 = lib.fakeSha256;
 
   preBuild = ''
     go generate ./...
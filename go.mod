@@ -7,12 +7,13 @@ module go.eth.moe/catbus-snapcast
 go 1.13
 
 require (
-	github.com/eclipse/paho.mqtt.golang v1.3.0 // indirect
+	github.com/BurntSushi/toml v0.3.1
+	github.com/eclipse/paho.mqtt.golang v1.3.0
 	github.com/hashicorp/mdns v1.0.3
 	github.com/miekg/dns v1.1.35 // indirect
-	go.eth.moe/catbus v0.0.6
 	go.eth.moe/flag v0.0.2
 	golang.org/x/crypto v0.0.0-20201208171446-5f87f3452ae9 // indirect
 	golang.org/x/net v0.0.0-20201209123823-ac852fbbde11 // indirect
 	golang.org/x/sys v0.0.0-20201211090839-8ad439b19e0f // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
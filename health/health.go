@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// Package health tracks the state of a daemon's connections, for health checks and systemd.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Checker tracks whether a daemon's connections are up.
+	Checker struct {
+		mu sync.Mutex
+
+		components  map[string]*component
+		lastStatus  time.Time
+		lastPublish time.Time
+	}
+
+	component struct {
+		up    bool
+		since time.Time
+	}
+
+	// Report is the JSON body served by the health endpoints.
+	Report struct {
+		Ready       bool                       `json:"ready"`
+		Components  map[string]ComponentReport `json:"components"`
+		LastStatus  *time.Time                 `json:"lastStatus,omitempty"`
+		LastPublish *time.Time                 `json:"lastPublish,omitempty"`
+	}
+
+	// ComponentReport is the state of one connection.
+	ComponentReport struct {
+		Up    bool       `json:"up"`
+		Since *time.Time `json:"since,omitempty"`
+	}
+)
+
+// Components.
+const (
+	MQTT       = "mqtt"
+	Snapserver = "snapserver"
+)
+
+// New returns a Checker that is ready when all of the given components are up.
+func New(components ...string) *Checker {
+	c := &Checker{
+		components: map[string]*component{},
+	}
+	for _, name := range components {
+		c.components[name] = &component{}
+	}
+	return c
+}
+
+// SetUp records whether a component is up.
+func (c *Checker) SetUp(name string, up bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	comp, ok := c.components[name]
+	if !ok {
+		comp = &component{}
+		c.components[name] = comp
+	}
+	if comp.up != up || comp.since.IsZero() {
+		comp.up = up
+		comp.since = time.Now()
+	}
+}
+
+// MarkStatus records a successful Server.GetStatus.
+func (c *Checker) MarkStatus() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastStatus = time.Now()
+}
+
+// MarkPublish records a successful MQTT publish.
+func (c *Checker) MarkPublish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastPublish = time.Now()
+}
+
+// Ready returns whether every component is up.
+func (c *Checker) Ready() bool {
+	return c.Report().Ready
+}
+
+// Report returns the current state of the Checker.
+func (c *Checker) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := Report{
+		Ready:      true,
+		Components: map[string]ComponentReport{},
+	}
+	for name, comp := range c.components {
+		cr := ComponentReport{Up: comp.up}
+		if !comp.since.IsZero() {
+			since := comp.since
+			cr.Since = &since
+		}
+		r.Components[name] = cr
+		r.Ready = r.Ready && comp.up
+	}
+	if !c.lastStatus.IsZero() {
+		lastStatus := c.lastStatus
+		r.LastStatus = &lastStatus
+	}
+	if !c.lastPublish.IsZero() {
+		lastPublish := c.lastPublish
+		r.LastPublish = &lastPublish
+	}
+	return r
+}
+
+// status describes which components are down, for systemd.
+func (c *Checker) status() string {
+	r := c.Report()
+	if r.Ready {
+		return "ready"
+	}
+
+	var down []string
+	for name, comp := range r.Components {
+		if !comp.Up {
+			down = append(down, name)
+		}
+	}
+	sort.Strings(down)
+	return "waiting for " + strings.Join(down, ", ")
+}
+
+// Register serves /healthz and /readyz on mux.
+// /healthz always succeeds while the daemon is running, and /readyz succeeds only when every component is up.
+// Both serve a JSON Report.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		c.serveReport(w, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		c.serveReport(w, true)
+	})
+}
+
+func (c *Checker) serveReport(w http.ResponseWriter, needReady bool) {
+	r := c.Report()
+
+	w.Header().Set("Content-Type", "application/json")
+	if needReady && !r.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(r)
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package health
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// NotifySystemd sends a state, such as "READY=1", to systemd's notification socket.
+// It does nothing if the daemon is not running under systemd with Type=notify.
+func NotifySystemd(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchSystemd tells systemd the daemon is ready once the Checker is first ready,
+// then pets systemd's watchdog (if WatchdogSec is set) until ctx is done.
+// The watchdog only checks that the daemon is alive: a daemon waiting for a connection to come back
+// keeps petting it, and reports the outage in its systemd status and /readyz instead of being restarted.
+func (c *Checker) WatchSystemd(ctx context.Context) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+
+	interval := time.Second
+	watchdog := false
+	if usec, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC")); err == nil && usec > 0 {
+		interval = time.Duration(usec) * time.Microsecond / 2
+		watchdog = true
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	notifiedReady := false
+	status := ""
+	for {
+		ready := c.Ready()
+		if ready && !notifiedReady {
+			if err := NotifySystemd("READY=1"); err != nil {
+				log.Printf("could not notify systemd: %v", err)
+			}
+			notifiedReady = true
+		}
+		if notifiedReady {
+			if s := c.status(); s != status {
+				if err := NotifySystemd("STATUS=" + s); err != nil {
+					log.Printf("could not notify systemd: %v", err)
+				}
+				status = s
+			}
+			if watchdog {
+				if err := NotifySystemd("WATCHDOG=1"); err != nil {
+					log.Printf("could not pet systemd watchdog: %v", err)
+				}
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// Package homeassistant builds Home Assistant MQTT discovery messages for Snapcast groups and speakers.
+//
+// It follows https://www.home-assistant.io/docs/mqtt/discovery/.
+package homeassistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+type (
+	// Message is a discovery config to publish, retained, to Topic.
+	Message struct {
+		Topic   string
+		Payload string
+	}
+
+	// Topics are the Catbus topics that entities read and write.
+	Topics struct {
+		// Input is the topic of the group's stream.
+		Input string
+		// GroupVolume is the topic of the group's volume.
+		GroupVolume string
+
+		// SpeakerVolume and SpeakerMute return the topics of a speaker's volume and mute.
+		SpeakerVolume func(snapcast.Speaker) string
+		SpeakerMute   func(snapcast.Speaker) string
+
+		// Availability are topics whose payload is "online" when the entities work.
+		Availability []string
+	}
+
+	entity struct {
+		Name     string `json:"name"`
+		UniqueID string `json:"unique_id"`
+		Device   device `json:"device"`
+
+		CommandTopic string `json:"command_topic"`
+		StateTopic   string `json:"state_topic"`
+		Retain       bool   `json:"retain"`
+
+		Availability     []availability `json:"availability,omitempty"`
+		AvailabilityMode string         `json:"availability_mode,omitempty"`
+
+		// For selects.
+		Options []string `json:"options,omitempty"`
+
+		// For numbers.
+		Min               *int   `json:"min,omitempty"`
+		Max               *int   `json:"max,omitempty"`
+		UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+
+		// For switches.
+		PayloadOn  string `json:"payload_on,omitempty"`
+		PayloadOff string `json:"payload_off,omitempty"`
+		Icon       string `json:"icon,omitempty"`
+	}
+
+	device struct {
+		Identifiers  []string `json:"identifiers"`
+		Name         string   `json:"name"`
+		Manufacturer string   `json:"manufacturer"`
+		ViaDevice    string   `json:"via_device,omitempty"`
+	}
+
+	availability struct {
+		Topic string `json:"topic"`
+	}
+)
+
+var (
+	invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+)
+
+// Discovery returns the discovery messages for a group and its speakers:
+// a select for the group's stream, and a number for each speaker's volume and a switch for each speaker's mute.
+func Discovery(prefix string, group snapcast.Group, streams []snapcast.Stream, topics Topics) ([]Message, error) {
+	var availabilities []availability
+	for _, topic := range topics.Availability {
+		availabilities = append(availabilities, availability{Topic: topic})
+	}
+	availabilityMode := ""
+	if len(availabilities) > 1 {
+		availabilityMode = "all"
+	}
+
+	groupName := group.Name
+	if groupName == "" {
+		groupName = group.ID
+	}
+	groupDevice := device{
+		Identifiers:  []string{uniqueID(group.ID)},
+		Name:         groupName,
+		Manufacturer: "Snapcast",
+	}
+
+	var options []string
+	for _, stream := range streams {
+		options = append(options, string(stream.ID))
+	}
+
+	var msgs []Message
+	add := func(component, objectID string, e entity) error {
+		e.Retain = true
+		e.Availability = availabilities
+		e.AvailabilityMode = availabilityMode
+
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("could not marshal %s %s: %w", component, objectID, err)
+		}
+		msgs = append(msgs, Message{
+			Topic:   path.Join(prefix, component, uniqueID(objectID), "config"),
+			Payload: string(payload),
+		})
+		return nil
+	}
+
+	if err := add("select", group.ID+"-input", entity{
+		Name:         groupName + " input",
+		UniqueID:     uniqueID(group.ID + "-input"),
+		Device:       groupDevice,
+		CommandTopic: topics.Input,
+		StateTopic:   topics.Input,
+		Options:      options,
+	}); err != nil {
+		return nil, err
+	}
+
+	min, max := 0, 100
+	if err := add("number", group.ID+"-volume", entity{
+		Name:              groupName + " volume",
+		UniqueID:          uniqueID(group.ID + "-volume"),
+		Device:            groupDevice,
+		CommandTopic:      topics.GroupVolume,
+		StateTopic:        topics.GroupVolume,
+		Min:               &min,
+		Max:               &max,
+		UnitOfMeasurement: "%",
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, speaker := range group.Speakers {
+		speakerDevice := device{
+			Identifiers:  []string{uniqueID(speaker.ID)},
+			Name:         speaker.Name,
+			Manufacturer: "Snapcast",
+			ViaDevice:    uniqueID(group.ID),
+		}
+
+		if err := add("number", speaker.ID+"-volume", entity{
+			Name:              speaker.Name + " volume",
+			UniqueID:          uniqueID(speaker.ID + "-volume"),
+			Device:            speakerDevice,
+			CommandTopic:      topics.SpeakerVolume(speaker),
+			StateTopic:        topics.SpeakerVolume(speaker),
+			Min:               &min,
+			Max:               &max,
+			UnitOfMeasurement: "%",
+		}); err != nil {
+			return nil, err
+		}
+
+		if err := add("switch", speaker.ID+"-mute", entity{
+			Name:         speaker.Name + " mute",
+			UniqueID:     uniqueID(speaker.ID + "-mute"),
+			Device:       speakerDevice,
+			CommandTopic: topics.SpeakerMute(speaker),
+			StateTopic:   topics.SpeakerMute(speaker),
+			PayloadOn:    "true",
+			PayloadOff:   "false",
+			Icon:         "mdi:volume-off",
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return msgs, nil
+}
+
+// uniqueID turns a Snapcast ID, such as a MAC address, into a Home Assistant ID.
+func uniqueID(id string) string {
+	return "catbus-snapcast-" + strings.ToLower(invalidIDChars.ReplaceAllString(id, "_"))
+}
@@ -2,7 +2,7 @@
 //
 // SPDX-License-Identifier: MIT
 
-// Package jsonrpc2 is a minimal JSON-RPC 2.0 client.
+// Package jsonrpc2 is a minimal JSON-RPC 2.0 client and server.
 //
 // Message format
 //
@@ -27,6 +27,10 @@
 // Notification:
 //
 //   { "jsonrpc": "2.0", "method": "update", "params": { "id": 12345, "name": "toasty" } }
+//
+// Batch request:
+//
+//   [ { "jsonrpc": "2.0", "id": 4, "method": "add", "params": [1, 2] }, { "jsonrpc": "2.0", "id": 5, "method": "add", "params": [3, 4] } ]
 package jsonrpc2
 
 import (
@@ -34,16 +38,36 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
 )
 
 type (
 	// Client is a JSON-RPC 2.0 client.
+	//
+	// Notifications are passed to handlers one at a time, in the order they arrived.
 	Client interface {
 		// Call performs a JSON-RPC 2.0 method call.
+		// It returns early if ctx is done, whether it is still sending the request or waiting for the response.
 		Call(ctx context.Context, method string, input interface{}, output interface{}) error
 
-		// SetNotificationHandler sets the callback for JSON-RPC 2.0 notifications.
+		// Batch returns a new Batch for sending several method calls in one round trip.
+		Batch() Batch
+
+		// SetNotificationHandler sets the callback for JSON-RPC 2.0 notifications, replacing any previously set with it.
+		// It is independent of Subscribe.
 		SetNotificationHandler(func(method string, payload json.RawMessage))
+
+		// Subscribe adds a callback for JSON-RPC 2.0 notifications of a given method, or of every method if method is AllMethods.
+		// A method can have many subscribers, called in the order they subscribed.
+		// The returned func removes the subscription.
+		Subscribe(method string, handler func(method string, payload json.RawMessage)) (unsubscribe func())
+
+		// DroppedNotifications returns how many notifications have been dropped because the queue was full.
+		DroppedNotifications() uint64
+
 		// Wait blocks until the connection fails.
 		Wait() error
 
@@ -51,6 +75,95 @@ type (
 		Close() error
 	}
 
+	// ClientOptions are options for a Client.
+	ClientOptions struct {
+		// Timeout is the default timeout for a Call or Batch.
+		// It applies in addition to any deadline on the Call's context, and is ignored if 0.
+		Timeout time.Duration
+
+		// NotificationQueueSize is how many notifications can wait for the notification handler.
+		// If 0, it defaults to 64.
+		NotificationQueueSize int
+
+		// NotificationOverflow is what to do with a notification that arrives while the queue is full.
+		NotificationOverflow OverflowPolicy
+
+		// CoalesceKey identifies notifications that supersede each other, for the Coalesce policy.
+		// If nil, only notifications with the same method and the same params supersede each other.
+		// Notifications about many things under one method, such as one speaker's volume among many, need a key that picks out the thing,
+		// or else a change to one thing could be discarded in favour of a change to another.
+		CoalesceKey func(method string, payload json.RawMessage) string
+
+		// CallInterceptors wrap every Call, outermost first.
+		// Each call in a Batch is intercepted on its own, and the Batch is sent once every call has been through them.
+		CallInterceptors []CallInterceptor
+
+		// NotificationInterceptors wrap the delivery of every notification to its handlers, outermost first.
+		NotificationInterceptors []NotificationInterceptor
+	}
+
+	// Invoker performs a JSON-RPC 2.0 method call.
+	Invoker func(ctx context.Context, method string, input interface{}, output interface{}) error
+
+	// CallInterceptor wraps a method call, and should call next to continue the call.
+	CallInterceptor func(ctx context.Context, method string, input interface{}, output interface{}, next Invoker) error
+
+	// NotificationInterceptor wraps the delivery of a notification, and should call next to continue delivering it.
+	NotificationInterceptor func(method string, payload json.RawMessage, next func(method string, payload json.RawMessage))
+
+	// OverflowPolicy is what a Client does when its notification queue is full.
+	OverflowPolicy int
+
+	// Server is a JSON-RPC 2.0 server.
+	Server interface {
+		// Register sets the handler for a method.
+		// The handler must be a func(context.Context, T) (U, error), where T and U can be (un)marshaled as JSON.
+		// Returning a RemoteError from the handler sends that error's code and message to the caller.
+		// If the handler panics, the caller gets an internal error, and the connection carries on.
+		Register(method string, handler interface{}) error
+
+		// Notify sends a JSON-RPC 2.0 notification to every connected peer.
+		Notify(method string, params interface{}) error
+
+		// NotifyOthers sends a JSON-RPC 2.0 notification to every connected peer except the one whose request ctx was passed to a handler for.
+		// With any other ctx, it notifies every connected peer.
+		NotifyOthers(ctx context.Context, method string, params interface{}) error
+
+		// Serve accepts connections on the listener and serves each one until the listener is closed.
+		Serve(net.Listener) error
+
+		// ServeConn serves a single connection, blocking until it is closed.
+		// Requests on a connection are handled in the order they arrive.
+		ServeConn(io.ReadWriteCloser)
+
+		// Close closes all listeners and connections.
+		Close() error
+	}
+
+	// Batch is a set of JSON-RPC 2.0 method calls sent together as a single message.
+	Batch interface {
+		// Call queues a method call, whose result will be unmarshaled into output when the Batch is sent.
+		Call(method string, input interface{}, output interface{})
+
+		// Send sends all queued method calls and waits for their responses.
+		// If any call fails, it returns a BatchError.
+		Send(ctx context.Context) error
+	}
+
+	// Record is a JSON-RPC 2.0 message recorded by a recording connection.
+	Record struct {
+		Time      time.Time       `json:"time"`
+		Direction Direction       `json:"direction"`
+		Message   json.RawMessage `json:"message"`
+	}
+
+	// Direction is whether a Record was sent or received.
+	Direction string
+
+	// BatchError is returned when one or more calls in a Batch fail.
+	// It holds one error per call, in the order they were queued, with nil for calls that succeeded.
+	BatchError []error
+
 	// RemoteError is an error returned by the server in response to an RPC.
 	RemoteError struct {
 		Code    int
@@ -58,11 +171,43 @@ type (
 	}
 )
 
+const (
+	// AllMethods subscribes to notifications of every method.
+	AllMethods = "*"
+)
+
+const (
+	// Block stops reading from the connection until the handler catches up.
+	// This also holds up responses to Calls.
+	Block = OverflowPolicy(iota)
+	// DropOldest discards the oldest queued notification.
+	DropOldest
+	// Coalesce discards the oldest queued notification with the same CoalesceKey, or else the oldest.
+	Coalesce
+)
+
+const (
+	// Inbound is a message received from the remote end.
+	Inbound = Direction("in")
+	// Outbound is a message sent to the remote end.
+	Outbound = Direction("out")
+)
+
 var (
 	// ErrDisconnected is returned when a Call is cancelled by network disconnection.
 	ErrDisconnected = errors.New("disconnected while waiting for response")
 )
 
+func (e BatchError) Error() string {
+	var failed []string
+	for i, err := range e {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("call %d: %v", i, err))
+		}
+	}
+	return fmt.Sprintf("batch error: %s", strings.Join(failed, "; "))
+}
+
 func (e RemoteError) Error() string {
 	return fmt.Sprintf("remote error: %s (code %d)", e.Message, e.Code)
 }
@@ -6,13 +6,16 @@ package jsonrpc2
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"sort"
 	"sync"
+	"time"
 )
 
 type (
@@ -22,33 +25,77 @@ type (
 		conn io.ReadWriteCloser
 
 		sequence int
+		timeout  time.Duration
 
+		connectionClosed    chan struct{}
 		errorChan           chan error
-		requestChan         chan *request
+		requestChan         chan interface{}
 		responseChans       map[int]chan *response
+		notifications       *notificationQueue
 		notificationHandler func(string, json.RawMessage)
+		subscriptions       map[string][]*subscription
+
+		// batches are the IDs of each Batch that has been sent but not yet answered, oldest first.
+		batches [][]int
+
+		interceptors []CallInterceptor
+		invoke       Invoker
+		dispatch     func(string, json.RawMessage)
 
 		disconnectHandler func(error)
 	}
+
+	subscription struct {
+		handler func(string, json.RawMessage)
+	}
+
+	batch struct {
+		client *client
+		calls  []batchCall
+	}
+	batchCall struct {
+		method string
+		params interface{}
+		result interface{}
+	}
+	// batchRequest is a call that has been through the interceptors, and is waiting for the Batch to be sent.
+	batchRequest struct {
+		index int
+		id    int
+		req   *request
+	}
 )
 
 const (
 	protocolVersion = "2.0"
 )
 
-// NewClient returns a new JSON-RPC 2.0 client.
+// NewClient returns a new JSON-RPC 2.0 client with the default options.
 func NewClient(conn net.Conn) Client {
+	return NewClientWithOptions(conn, ClientOptions{})
+}
+
+// NewClientWithOptions returns a new JSON-RPC 2.0 client.
+func NewClientWithOptions(conn net.Conn, opts ClientOptions) Client {
 	c := &client{
-		conn: conn,
+		conn:    conn,
+		timeout: opts.Timeout,
 
-		errorChan:     make(chan error),
-		requestChan:   make(chan *request),
-		responseChans: map[int]chan *response{},
+		connectionClosed: make(chan struct{}),
+		errorChan:        make(chan error),
+		requestChan:      make(chan interface{}),
+		responseChans:    map[int]chan *response{},
+		subscriptions:    map[string][]*subscription{},
+		notifications:    newNotificationQueue(opts.NotificationQueueSize, opts.NotificationOverflow, opts.CoalesceKey),
 	}
 
-	connectionClosed := make(chan struct{})
-	go c.readLoop(connectionClosed)
-	go c.writeLoop(connectionClosed)
+	c.interceptors = opts.CallInterceptors
+	c.invoke = chainCallInterceptors(opts.CallInterceptors, c.call)
+	c.dispatch = chainNotificationInterceptors(opts.NotificationInterceptors, c.notify)
+
+	go c.readLoop(c.connectionClosed)
+	go c.writeLoop(c.connectionClosed)
+	go c.dispatchLoop()
 
 	return c
 }
@@ -61,12 +108,49 @@ func (c *client) Wait() error {
 }
 
 func (c *client) SetNotificationHandler(f func(string, json.RawMessage)) {
+	c.Lock()
+	defer c.Unlock()
 	c.notificationHandler = f
 }
 
+func (c *client) Subscribe(method string, f func(string, json.RawMessage)) func() {
+	c.Lock()
+	defer c.Unlock()
+
+	sub := &subscription{handler: f}
+	c.subscriptions[method] = append(c.subscriptions[method], sub)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.Lock()
+			defer c.Unlock()
+
+			subs := c.subscriptions[method]
+			for i := range subs {
+				if subs[i] == sub {
+					// Copy rather than splice, as dispatchLoop may be iterating over the old slice.
+					subs = append(append([]*subscription{}, subs[:i]...), subs[i+1:]...)
+					break
+				}
+			}
+			if len(subs) == 0 {
+				delete(c.subscriptions, method)
+			} else {
+				c.subscriptions[method] = subs
+			}
+		})
+	}
+}
+
+func (c *client) DroppedNotifications() uint64 {
+	return c.notifications.droppedCount()
+}
+
 func (c *client) readLoop(connectionClosed chan struct{}) {
 	defer close(connectionClosed)
 	defer close(c.errorChan)
+	defer c.notifications.close()
 	defer func() {
 		c.Lock()
 		defer c.Unlock()
@@ -88,28 +172,113 @@ func (c *client) readLoop(connectionClosed chan struct{}) {
 			return
 		}
 
-		rsp := &response{}
-		if err := json.Unmarshal(data, rsp); err == nil && rsp.ID != nil {
-			c.Lock()
-			// if noöne requested it, throw it away.
-			if ch, ok := c.responseChans[*rsp.ID]; ok {
-				ch <- rsp
-				close(ch)
-				delete(c.responseChans, *rsp.ID)
+		// Batch responses arrive as a JSON array of messages.
+		if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+			var messages []json.RawMessage
+			if err := json.Unmarshal(data, &messages); err != nil {
+				log.Printf("unknown inbound message: %s", data)
+				continue
+			}
+			for _, message := range messages {
+				c.handleMessage(message)
 			}
-			c.Unlock()
 			continue
 		}
 
-		noti := notification{}
-		if err := json.Unmarshal(data, &noti); err == nil && noti.Method != "" {
-			if c.notificationHandler != nil {
-				go c.notificationHandler(noti.Method, noti.Params)
+		c.handleMessage(data)
+	}
+}
+
+func (c *client) handleMessage(data []byte) {
+	rsp := &response{}
+	if err := json.Unmarshal(data, rsp); err == nil && rsp.ID != nil {
+		c.Lock()
+		c.forgetBatch(*rsp.ID)
+		c.respond(*rsp.ID, rsp)
+		c.Unlock()
+		return
+	}
+
+	// A peer that cannot make sense of a Batch at all answers it with a single error with a null ID.
+	if rsp.Error != nil {
+		c.Lock()
+		if len(c.batches) > 0 {
+			ids := c.batches[0]
+			c.batches = c.batches[1:]
+			for _, id := range ids {
+				id := id
+				c.respond(id, &response{
+					ProtocolVersion: rsp.ProtocolVersion,
+					ID:              &id,
+					Error:           rsp.Error,
+				})
+			}
+			c.Unlock()
+			return
+		}
+		c.Unlock()
+	}
+
+	noti := &notification{}
+	if err := json.Unmarshal(data, noti); err == nil && noti.Method != "" {
+		c.notifications.push(noti)
+		return
+	}
+
+	log.Printf("unknown inbound message: %s", data)
+}
+
+// respond hands a response to the caller waiting on id, or throws it away if noöne is.
+// It must be called with c locked.
+func (c *client) respond(id int, rsp *response) {
+	if ch, ok := c.responseChans[id]; ok {
+		ch <- rsp
+		close(ch)
+		delete(c.responseChans, id)
+	}
+}
+
+// forgetBatch stops tracking the Batch that a request belongs to, if any, as it has been answered.
+// It must be called with c locked.
+func (c *client) forgetBatch(id int) {
+	for i, ids := range c.batches {
+		for _, batchID := range ids {
+			if batchID == id {
+				c.batches = append(c.batches[:i:i], c.batches[i+1:]...)
+				return
 			}
-			continue
 		}
+	}
+}
+
+// dispatchLoop calls the notification handlers for each notification, one at a time, in the order they arrived.
+func (c *client) dispatchLoop() {
+	for {
+		noti, ok := c.notifications.pop()
+		if !ok {
+			return
+		}
+
+		c.dispatch(noti.Method, noti.Params)
+	}
+}
 
-		log.Printf("unknown inbound message: %s", data)
+// notify passes a notification to its handlers.
+func (c *client) notify(method string, params json.RawMessage) {
+	c.Lock()
+	handler := c.notificationHandler
+	subs := c.subscriptions[method]
+	wildcardSubs := c.subscriptions[AllMethods]
+	c.Unlock()
+
+	if handler != nil {
+		handler(method, params)
+	}
+	for _, sub := range subs {
+		sub.handler(method, params)
+	}
+	for _, sub := range wildcardSubs {
+		sub.handler(method, params)
 	}
 }
 
@@ -134,6 +303,11 @@ func (c *client) writeLoop(connectionClosed chan struct{}) {
 }
 
 func (c *client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	return c.invoke(ctx, method, params, result)
+}
+
+// call performs a method call, after any interceptors.
+func (c *client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
 	id, ch := c.newRequest()
 
 	req := &request{
@@ -143,29 +317,158 @@ func (c *client) Call(ctx context.Context, method string, params interface{}, re
 		Params:          params,
 	}
 
-	c.requestChan <- req
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if err := c.send(ctx, req, id); err != nil {
+		return err
+	}
 
 	select {
 	case rsp := <-ch:
-		if rsp == nil {
-			return ErrDisconnected
-		}
-		if rsp.Error != nil {
-			return RemoteError{
-				Code:    rsp.Error.Code,
-				Message: rsp.Error.Message,
+		return unmarshalResponse(rsp, result)
+	case <-ctx.Done():
+		c.abandon(id)
+		return ctx.Err()
+	}
+}
+
+func (c *client) Batch() Batch {
+	return &batch{client: c}
+}
+
+func (b *batch) Call(method string, params interface{}, result interface{}) {
+	b.calls = append(b.calls, batchCall{
+		method: method,
+		params: params,
+		result: result,
+	})
+}
+
+// Send runs each call through the client's interceptors in its own goroutine.
+// A call joins the batch when it reaches the end of the interceptor chain,
+// and the batch is sent once every call has joined it or been answered by an interceptor.
+// If an interceptor calls next again after the batch has been sent, e.g. to retry, that call is sent on its own.
+func (b *batch) Send(ctx context.Context) error {
+	if len(b.calls) == 0 {
+		return nil
+	}
+
+	ctx, cancel := b.client.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		pending []batchRequest
+		sent    bool
+		sendErr error
+	)
+	arrived := make(chan struct{}, len(b.calls))
+	sentChan := make(chan struct{})
+
+	errs := make(BatchError, len(b.calls))
+	var wg sync.WaitGroup
+	for i, call := range b.calls {
+		wg.Add(1)
+		go func(i int, call batchCall) {
+			defer wg.Done()
+
+			joined := false
+			invoke := func(ctx context.Context, method string, params interface{}, result interface{}) error {
+				mu.Lock()
+				if sent || joined {
+					mu.Unlock()
+					return b.client.call(ctx, method, params, result)
+				}
+				joined = true
+				id, ch := b.client.newRequest()
+				pending = append(pending, batchRequest{
+					index: i,
+					id:    id,
+					req: &request{
+						ProtocolVersion: protocolVersion,
+						ID:              id,
+						Method:          method,
+						Params:          params,
+					},
+				})
+				mu.Unlock()
+				arrived <- struct{}{}
+
+				<-sentChan
+				if sendErr != nil {
+					return sendErr
+				}
+				select {
+				case rsp := <-ch:
+					return unmarshalResponse(rsp, result)
+				case <-ctx.Done():
+					b.client.abandon(id)
+					return ctx.Err()
+				}
 			}
-		}
-		if result != nil {
-			if err := json.Unmarshal(rsp.Result, result); err != nil {
-				return fmt.Errorf("could not unmarshal result payload: %w", err)
+
+			errs[i] = chainCallInterceptors(b.client.interceptors, invoke)(ctx, call.method, call.params, call.result)
+
+			mu.Lock()
+			answered := !joined
+			joined = true
+			mu.Unlock()
+			if answered {
+				arrived <- struct{}{}
 			}
+		}(i, call)
+	}
+
+	for range b.calls {
+		select {
+		case <-arrived:
+		case <-ctx.Done():
+			sendErr = ctx.Err()
+		}
+		if sendErr != nil {
+			break
 		}
-	case <-ctx.Done():
-		return ctx.Err()
 	}
 
-	return nil
+	mu.Lock()
+	sent = true
+	sort.Slice(pending, func(i, j int) bool { return pending[i].index < pending[j].index })
+	reqs := make([]*request, len(pending))
+	ids := make([]int, len(pending))
+	for i, p := range pending {
+		reqs[i] = p.req
+		ids[i] = p.id
+	}
+	mu.Unlock()
+
+	if sendErr == nil && len(reqs) > 0 {
+		b.client.Lock()
+		b.client.batches = append(b.client.batches, ids)
+		b.client.Unlock()
+		sendErr = b.client.send(ctx, reqs, ids...)
+	} else if sendErr != nil {
+		b.client.abandon(ids...)
+	}
+	close(sentChan)
+	wg.Wait()
+
+	if sendErr != nil {
+		return sendErr
+	}
+	failed := false
+	for _, err := range errs {
+		if err != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errs
 }
 
 func (c *client) newRequest() (int, <-chan *response) {
@@ -175,8 +478,61 @@ func (c *client) newRequest() (int, <-chan *response) {
 	id := c.sequence
 	c.sequence++
 
-	ch := make(chan *response)
+	// Buffered so that readLoop never blocks on a caller that is still
+	// waiting on an earlier response, e.g. within a Batch.
+	ch := make(chan *response, 1)
 	c.responseChans[id] = ch
 
 	return id, ch
 }
+
+// send hands a request or batch of requests to writeLoop.
+// If it fails, the requests' response channels are abandoned.
+func (c *client) send(ctx context.Context, req interface{}, ids ...int) error {
+	select {
+	case c.requestChan <- req:
+		return nil
+	case <-c.connectionClosed:
+		c.abandon(ids...)
+		return ErrDisconnected
+	case <-ctx.Done():
+		c.abandon(ids...)
+		return ctx.Err()
+	}
+}
+
+// abandon forgets the response channels of requests whose callers have given up on them.
+func (c *client) abandon(ids ...int) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, id := range ids {
+		delete(c.responseChans, id)
+	}
+}
+
+// withTimeout applies the client's default timeout, if any, to ctx.
+func (c *client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func unmarshalResponse(rsp *response, result interface{}) error {
+	if rsp == nil {
+		return ErrDisconnected
+	}
+	if rsp.Error != nil {
+		return RemoteError{
+			Code:    rsp.Error.Code,
+			Message: rsp.Error.Message,
+		}
+	}
+	if result != nil {
+		if err := json.Unmarshal(rsp.Result, result); err != nil {
+			return fmt.Errorf("could not unmarshal result payload: %w", err)
+		}
+	}
+	return nil
+}
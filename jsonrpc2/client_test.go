@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	c, done := newTestClient(newTestServer(t), ClientOptions{})
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var first, second int
+	b := c.Batch()
+	b.Call("add", addParams{A: 1, B: 2}, &first)
+	b.Call("add", addParams{A: 3, B: 4}, &second)
+	if err := b.Send(ctx); err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+	if first != 3 || second != 7 {
+		t.Errorf("Send() set results %d and %d, want 3 and 7", first, second)
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	c, done := newTestClient(newTestServer(t), ClientOptions{})
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var sum int
+	b := c.Batch()
+	b.Call("add", addParams{A: 1, B: 2}, &sum)
+	b.Call("fail", nil, nil)
+	err := b.Send(ctx)
+
+	var batchErr BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Send() returned %v, want BatchError", err)
+	}
+	if len(batchErr) != 2 || batchErr[0] != nil || batchErr[1] == nil {
+		t.Errorf("Send() returned %v, want only the second call to fail", batchErr)
+	}
+	if sum != 3 {
+		t.Errorf("Send() set result %d, want 3", sum)
+	}
+}
+
+func TestBatchInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var intercepted []string
+	record := func(ctx context.Context, method string, params interface{}, result interface{}, next Invoker) error {
+		mu.Lock()
+		intercepted = append(intercepted, method)
+		mu.Unlock()
+		return next(ctx, method, params, result)
+	}
+	// answer short-circuits "cached" calls, and rewrites "double" calls into "add".
+	answer := func(ctx context.Context, method string, params interface{}, result interface{}, next Invoker) error {
+		switch method {
+		case "cached":
+			*result.(*int) = 99
+			return nil
+		case "double":
+			p := params.(addParams)
+			return next(ctx, "add", addParams{A: p.A, B: p.A}, result)
+		}
+		return next(ctx, method, params, result)
+	}
+
+	c, done := newTestClient(newTestServer(t), ClientOptions{
+		CallInterceptors: []CallInterceptor{record, answer},
+	})
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var sum, cached, doubled int
+	b := c.Batch()
+	b.Call("add", addParams{A: 1, B: 2}, &sum)
+	b.Call("cached", nil, &cached)
+	b.Call("double", addParams{A: 5}, &doubled)
+	if err := b.Send(ctx); err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+	if sum != 3 || cached != 99 || doubled != 10 {
+		t.Errorf("Send() set results %d, %d, and %d, want 3, 99, and 10", sum, cached, doubled)
+	}
+
+	sort.Strings(intercepted)
+	if want := []string{"add", "cached", "double"}; !reflect.DeepEqual(intercepted, want) {
+		t.Errorf("intercepted %v, want %v", intercepted, want)
+	}
+}
+
+func TestBatchEmpty(t *testing.T) {
+	c, done := newTestClient(newTestServer(t), ClientOptions{})
+	defer done()
+
+	if err := c.Batch().Send(context.Background()); err != nil {
+		t.Errorf("Send() of an empty Batch returned %v, want nil", err)
+	}
+}
+
+func TestBatchNullIDError(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+
+	// The peer answers the whole batch with a single error, as a server that cannot parse it would.
+	go func() {
+		if _, err := bufio.NewReader(serverConn).ReadBytes('\n'); err != nil {
+			return
+		}
+		serverConn.Write([]byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid batch"}}` + "\r\n"))
+	}()
+
+	c := NewClient(clientConn)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	b := c.Batch()
+	b.Call("add", addParams{A: 1, B: 2}, nil)
+	b.Call("add", addParams{A: 3, B: 4}, nil)
+	err := b.Send(ctx)
+
+	var batchErr BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Send() returned %v, want BatchError", err)
+	}
+	if len(batchErr) != 2 {
+		t.Fatalf("Send() returned %v, want an error for each call", batchErr)
+	}
+	for i, err := range batchErr {
+		var remoteErr RemoteError
+		if !errors.As(err, &remoteErr) || remoteErr.Code != CodeInvalidRequest {
+			t.Errorf("call %d failed with %v, want RemoteError with code %d", i, err, CodeInvalidRequest)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// LogCalls returns a CallInterceptor that logs each call's method, duration, and error.
+// If logger is nil, it uses the standard logger.
+func LogCalls(logger *log.Logger) CallInterceptor {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return func(ctx context.Context, method string, params interface{}, result interface{}, next Invoker) error {
+		start := time.Now()
+		err := next(ctx, method, params, result)
+		if err != nil {
+			logger.Printf("call %s failed after %v: %v", method, time.Since(start), err)
+		} else {
+			logger.Printf("call %s took %v", method, time.Since(start))
+		}
+		return err
+	}
+}
+
+// LogNotifications returns a NotificationInterceptor that logs each notification's method and payload.
+// If logger is nil, it uses the standard logger.
+func LogNotifications(logger *log.Logger) NotificationInterceptor {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return func(method string, payload json.RawMessage, next func(string, json.RawMessage)) {
+		logger.Printf("notification %s: %s", method, payload)
+		next(method, payload)
+	}
+}
+
+func chainCallInterceptors(interceptors []CallInterceptor, invoke Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, method string, params interface{}, result interface{}) error {
+			return interceptor(ctx, method, params, result, next)
+		}
+	}
+	return invoke
+}
+
+func chainNotificationInterceptors(interceptors []NotificationInterceptor, dispatch func(string, json.RawMessage)) func(string, json.RawMessage) {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], dispatch
+		dispatch = func(method string, payload json.RawMessage) {
+			interceptor(method, payload, next)
+		}
+	}
+	return dispatch
+}
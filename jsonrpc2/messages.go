@@ -23,6 +23,18 @@ type (
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 	}
+	serverRequest struct {
+		ProtocolVersion string          `json:"jsonrpc"`
+		ID              json.RawMessage `json:"id,omitempty"`
+		Method          string          `json:"method"`
+		Params          json.RawMessage `json:"params,omitempty"`
+	}
+	serverResponse struct {
+		ProtocolVersion string          `json:"jsonrpc"`
+		ID              json.RawMessage `json:"id"`
+		Result          json.RawMessage `json:"result,omitempty"`
+		Error           *responseError  `json:"error,omitempty"`
+	}
 	notification struct {
 		ProtocolVersion string          `json:"jsonrpc"`
 		Method          string          `json:"method"`
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+type (
+	// notificationQueue is a bounded FIFO of notifications waiting to be dispatched.
+	notificationQueue struct {
+		sync.Mutex
+		cond *sync.Cond
+
+		items  []*notification
+		size   int
+		policy OverflowPolicy
+		key    func(method string, params json.RawMessage) string
+
+		closed  bool
+		dropped uint64
+	}
+)
+
+const (
+	defaultNotificationQueueSize = 64
+)
+
+func newNotificationQueue(size int, policy OverflowPolicy, key func(string, json.RawMessage) string) *notificationQueue {
+	if size <= 0 {
+		size = defaultNotificationQueueSize
+	}
+	if key == nil {
+		key = defaultCoalesceKey
+	}
+	q := &notificationQueue{
+		size:   size,
+		policy: policy,
+		key:    key,
+	}
+	q.cond = sync.NewCond(q)
+	return q
+}
+
+// push adds a notification to the back of the queue, applying the overflow policy if it is full.
+func (q *notificationQueue) push(n *notification) {
+	q.Lock()
+	defer q.Unlock()
+
+	for len(q.items) >= q.size && q.policy == Block && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return
+	}
+
+	if len(q.items) >= q.size {
+		q.dropped++
+
+		i := 0
+		if q.policy == Coalesce {
+			k := q.key(n.Method, n.Params)
+			for j, item := range q.items {
+				if q.key(item.Method, item.Params) == k {
+					i = j
+					break
+				}
+			}
+		}
+		q.items = append(q.items[:i], q.items[i+1:]...)
+	}
+
+	q.items = append(q.items, n)
+	q.cond.Broadcast()
+}
+
+// pop removes and returns the notification at the front of the queue, blocking until there is one.
+// It returns false once the queue is closed and empty.
+func (q *notificationQueue) pop() (*notification, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+
+	n := q.items[0]
+	q.items = q.items[1:]
+	q.cond.Broadcast()
+	return n, true
+}
+
+// close stops the queue accepting notifications; those already queued can still be popped.
+func (q *notificationQueue) close() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *notificationQueue) droppedCount() uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.dropped
+}
+
+// defaultCoalesceKey makes only repeats of the same notification supersede each other, as different params can be about different things.
+func defaultCoalesceKey(method string, params json.RawMessage) string {
+	return method + " " + string(params)
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotificationQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      OverflowPolicy
+		key         func(string, json.RawMessage) string
+		push        []string
+		params      []string
+		want        []string
+		wantParams  []string
+		wantDropped uint64
+	}{
+		{
+			name:   "drop oldest, not full",
+			policy: DropOldest,
+			push:   []string{"a", "b"},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:        "drop oldest",
+			policy:      DropOldest,
+			push:        []string{"a", "b", "c", "d"},
+			want:        []string{"c", "d"},
+			wantDropped: 2,
+		},
+		{
+			name:        "coalesce with the same method",
+			policy:      Coalesce,
+			push:        []string{"a", "b", "a"},
+			want:        []string{"b", "a"},
+			wantDropped: 1,
+		},
+		{
+			name:        "coalesce with the same method but different params",
+			policy:      Coalesce,
+			push:        []string{"a", "a", "a"},
+			params:      []string{`{"id":1}`, `{"id":2}`, `{"id":1}`},
+			want:        []string{"a", "a"},
+			wantParams:  []string{`{"id":2}`, `{"id":1}`},
+			wantDropped: 1,
+		},
+		{
+			name:        "coalesce without the same method",
+			policy:      Coalesce,
+			push:        []string{"a", "b", "c"},
+			want:        []string{"b", "c"},
+			wantDropped: 1,
+		},
+		{
+			name:   "coalesce with a key",
+			policy: Coalesce,
+			key: func(method string, _ json.RawMessage) string {
+				return method[:1]
+			},
+			push:        []string{"x1", "y1", "y2"},
+			want:        []string{"x1", "y2"},
+			wantDropped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newNotificationQueue(2, tt.policy, tt.key)
+			for i, method := range tt.push {
+				n := &notification{Method: method}
+				if i < len(tt.params) {
+					n.Params = json.RawMessage(tt.params[i])
+				}
+				q.push(n)
+			}
+			q.close()
+
+			var got, gotParams []string
+			for {
+				n, ok := q.pop()
+				if !ok {
+					break
+				}
+				got = append(got, n.Method)
+				gotParams = append(gotParams, string(n.Params))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("popped %v, want %v", got, tt.want)
+			}
+			if tt.wantParams != nil && !reflect.DeepEqual(gotParams, tt.wantParams) {
+				t.Errorf("popped params %v, want %v", gotParams, tt.wantParams)
+			}
+			if dropped := q.droppedCount(); dropped != tt.wantDropped {
+				t.Errorf("dropped %d, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestNotificationQueueBlock(t *testing.T) {
+	q := newNotificationQueue(1, Block, nil)
+	q.push(&notification{Method: "a"})
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push(&notification{Method: "b"})
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push() to a full queue returned without blocking")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if n, _ := q.pop(); n.Method != "a" {
+		t.Errorf("popped %v, want a", n.Method)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push() still blocked after pop()")
+	}
+	if n, _ := q.pop(); n.Method != "b" {
+		t.Errorf("popped %v, want b", n.Method)
+	}
+	if dropped := q.droppedCount(); dropped != 0 {
+		t.Errorf("dropped %d, want 0", dropped)
+	}
+}
+
+func TestNotificationQueueClose(t *testing.T) {
+	q := newNotificationQueue(1, Block, nil)
+	q.push(&notification{Method: "a"})
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push(&notification{Method: "b"})
+		close(pushed)
+	}()
+	q.close()
+
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push() still blocked after close()")
+	}
+	if n, ok := q.pop(); !ok || n.Method != "a" {
+		t.Errorf("pop() = %v, %v, want a, true", n, ok)
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("pop() of a closed, empty queue returned true")
+	}
+}
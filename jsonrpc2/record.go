@@ -0,0 +1,284 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	recordingConn struct {
+		net.Conn
+
+		mu      sync.Mutex
+		encoder *json.Encoder
+
+		inbound  []byte
+		outbound []byte
+	}
+
+	// replayWriter serializes writes from answering requests and sending notifications.
+	replayWriter struct {
+		mu sync.Mutex
+		w  io.Writer
+	}
+
+	// recordedMessage is the union of the fields that tell a request, response, and notification apart.
+	recordedMessage struct {
+		ID     json.RawMessage `json:"id,omitempty"`
+		Method string          `json:"method"`
+	}
+)
+
+// NewRecordingConn wraps conn, writing every message sent or received on it to w as JSONL Records.
+func NewRecordingConn(conn net.Conn, w io.Writer) net.Conn {
+	return &recordingConn{
+		Conn:    conn,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.record(Inbound, p[:n])
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.record(Outbound, p[:n])
+	return n, err
+}
+
+// record buffers data until it has whole lines, then writes each line as a Record.
+func (c *recordingConn) record(direction Direction, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf := &c.inbound
+	if direction == Outbound {
+		buf = &c.outbound
+	}
+	*buf = append(*buf, data...)
+
+	for {
+		i := bytes.IndexByte(*buf, '\n')
+		if i < 0 {
+			return
+		}
+		line := bytes.TrimSpace((*buf)[:i])
+		*buf = (*buf)[i+1:]
+
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			log.Printf("not recording invalid %s message: %s", direction, line)
+			continue
+		}
+
+		record := Record{
+			Time:      time.Now(),
+			Direction: direction,
+			Message:   append(json.RawMessage{}, line...),
+		}
+		if err := c.encoder.Encode(record); err != nil {
+			log.Printf("could not write record: %v", err)
+		}
+	}
+}
+
+// ReadRecording reads JSONL Records, as written by a recording connection.
+func ReadRecording(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("could not parse record on line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Replay plays a recording back to conn, as the peer that was recorded.
+// It answers each request from conn with the response recorded for that method, rewritten to the request's ID.
+// A method's recorded responses are used in order, and the last one is repeated once they run out.
+// Meanwhile, it sends the recording's Inbound notifications with their original timing, sped up by speed.
+// A speed of 0 or less sends every notification immediately.
+// It returns once every notification has been sent and the peer has closed the connection, or ctx is done.
+func Replay(ctx context.Context, conn io.ReadWriter, records []Record, speed float64) error {
+	w := &replayWriter{w: conn}
+
+	answered := make(chan error, 1)
+	go func() {
+		answered <- answerRequests(conn, w, recordedResponses(records))
+	}()
+
+	var start time.Time
+	began := time.Now()
+	for _, record := range records {
+		if record.Direction != Inbound || !isNotification(record.Message) {
+			continue
+		}
+		if start.IsZero() {
+			start = record.Time
+		}
+
+		if speed > 0 {
+			offset := time.Duration(float64(record.Time.Sub(start)) / speed)
+			select {
+			case <-time.After(time.Until(began.Add(offset))):
+			case err := <-answered:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := w.write(record.Message); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case err := <-answered:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *replayWriter) write(packet []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := w.w.Write(append(append([]byte{}, packet...), []byte("\r\n")...))
+	return err
+}
+
+// recordedResponses returns the Inbound responses of a recording by the method of the Outbound request they answered, in the order they were received.
+func recordedResponses(records []Record) map[string][]serverResponse {
+	methods := map[string]string{}
+	responses := map[string][]serverResponse{}
+	for _, record := range records {
+		for _, data := range splitBatch(record.Message) {
+			msg := recordedMessage{}
+			if err := json.Unmarshal(data, &msg); err != nil || msg.ID == nil {
+				continue
+			}
+
+			switch {
+			case record.Direction == Outbound && msg.Method != "":
+				methods[string(msg.ID)] = msg.Method
+			case record.Direction == Inbound && msg.Method == "":
+				method, ok := methods[string(msg.ID)]
+				if !ok {
+					continue
+				}
+				rsp := serverResponse{}
+				if err := json.Unmarshal(data, &rsp); err != nil {
+					continue
+				}
+				responses[method] = append(responses[method], rsp)
+			}
+		}
+	}
+	return responses
+}
+
+// answerRequests answers every request read from r with a recorded response, until r is closed.
+func answerRequests(r io.Reader, w *replayWriter, responses map[string][]serverResponse) error {
+	reader := bufio.NewReader(r)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			if rsp := answerPacket(data, responses); rsp != nil {
+				if err := w.write(rsp); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// answerPacket returns the packet answering a single inbound line, which may be one message or a batch, or nil if there is nothing to send.
+func answerPacket(data []byte, responses map[string][]serverResponse) []byte {
+	var rsps []*serverResponse
+	for _, message := range splitBatch(data) {
+		req := serverRequest{}
+		if err := json.Unmarshal(message, &req); err != nil {
+			rsps = append(rsps, errorResponse(nil, CodeParseError, err.Error()))
+			continue
+		}
+		if req.ID == nil {
+			continue
+		}
+
+		recorded := responses[req.Method]
+		if len(recorded) == 0 {
+			rsps = append(rsps, errorResponse(req.ID, CodeMethodNotFound, fmt.Sprintf("no recorded response for method: %s", req.Method)))
+			continue
+		}
+		rsp := recorded[0]
+		if len(recorded) > 1 {
+			responses[req.Method] = recorded[1:]
+		}
+		rsp.ID = req.ID
+		rsps = append(rsps, &rsp)
+	}
+
+	switch {
+	case len(rsps) == 0:
+		return nil
+	case data[0] != '[':
+		return mustMarshal(rsps[0])
+	default:
+		return mustMarshal(rsps)
+	}
+}
+
+// splitBatch returns the messages of a batch, or data itself if it is not a batch.
+func splitBatch(data []byte) []json.RawMessage {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		return []json.RawMessage{data}
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return []json.RawMessage{data}
+	}
+	return messages
+}
+
+// isNotification returns whether a recorded message is a notification.
+func isNotification(data []byte) bool {
+	msg := recordedMessage{}
+	return json.Unmarshal(data, &msg) == nil && msg.Method != "" && msg.ID == nil
+}
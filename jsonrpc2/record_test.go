@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: at, Direction: Outbound, Message: json.RawMessage(`{"jsonrpc":"2.0","id":7,"method":"add","params":{"a":1,"b":2}}`)},
+		{Time: at, Direction: Inbound, Message: json.RawMessage(`{"jsonrpc":"2.0","id":7,"result":3}`)},
+		{Time: at.Add(time.Second), Direction: Inbound, Message: json.RawMessage(`{"jsonrpc":"2.0","method":"added","params":{"sum":3}}`)},
+		{Time: at.Add(2 * time.Second), Direction: Outbound, Message: json.RawMessage(`[{"jsonrpc":"2.0","id":8,"method":"add","params":{"a":2,"b":2}},{"jsonrpc":"2.0","id":9,"method":"fail"}]`)},
+		{Time: at.Add(2 * time.Second), Direction: Inbound, Message: json.RawMessage(`[{"jsonrpc":"2.0","id":9,"error":{"code":42,"message":"failed"}},{"jsonrpc":"2.0","id":8,"result":4}]`)},
+	}
+
+	serverConn, clientConn := net.Pipe()
+	replayed := make(chan error, 1)
+	go func() {
+		replayed <- Replay(context.Background(), serverConn, records, 0)
+	}()
+
+	notified := make(chan string, 1)
+	c := NewClient(clientConn)
+	c.Subscribe(AllMethods, func(method string, _ json.RawMessage) { notified <- method })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	select {
+	case got := <-notified:
+		if got != "added" {
+			t.Errorf("notified of %s, want added", got)
+		}
+	case <-ctx.Done():
+		t.Error("not notified")
+	}
+
+	// Each call gets the next recorded response for its method, and the last one once they run out.
+	for _, want := range []int{3, 4, 4} {
+		var sum int
+		if err := c.Call(ctx, "add", addParams{A: 5, B: 5}, &sum); err != nil {
+			t.Fatalf("Call(add) returned error: %v", err)
+		}
+		if sum != want {
+			t.Errorf("Call(add) = %d, want %d", sum, want)
+		}
+	}
+
+	tests := []struct {
+		method   string
+		wantCode int
+	}{
+		{"fail", 42},
+		{"missing", CodeMethodNotFound},
+	}
+	for _, tt := range tests {
+		err := c.Call(ctx, tt.method, nil, nil)
+
+		var remoteErr RemoteError
+		if !errors.As(err, &remoteErr) || remoteErr.Code != tt.wantCode {
+			t.Errorf("Call(%s) returned %v, want RemoteError with code %d", tt.method, err, tt.wantCode)
+		}
+	}
+
+	c.Close()
+	select {
+	case err := <-replayed:
+		if err != nil {
+			t.Errorf("Replay() returned error: %v", err)
+		}
+	case <-ctx.Done():
+		t.Error("Replay() did not return once the peer closed the connection")
+	}
+}
@@ -0,0 +1,334 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"reflect"
+	"sync"
+)
+
+type (
+	server struct {
+		sync.Mutex
+
+		methods   map[string]handler
+		conns     map[*serverConn]struct{}
+		listeners map[net.Listener]struct{}
+	}
+
+	handler struct {
+		fn     reflect.Value
+		params reflect.Type
+	}
+
+	serverConn struct {
+		sync.Mutex
+
+		conn io.ReadWriteCloser
+	}
+
+	// connKey is the context key under which a handler's context carries the connection its request arrived on.
+	connKey struct{}
+)
+
+// Standard JSON-RPC 2.0 error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// NewServer returns a new JSON-RPC 2.0 server.
+func NewServer() Server {
+	return &server{
+		methods:   map[string]handler{},
+		conns:     map[*serverConn]struct{}{},
+		listeners: map[net.Listener]struct{}{},
+	}
+}
+
+func (s *server) Register(method string, f interface{}) error {
+	fn := reflect.ValueOf(f)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 || t.In(0) != contextType || t.Out(1) != errorType {
+		return fmt.Errorf("handler for %s must be a func(context.Context, T) (U, error), got %v", method, t)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.methods[method] = handler{
+		fn:     fn,
+		params: t.In(1),
+	}
+	return nil
+}
+
+func (s *server) Notify(method string, params interface{}) error {
+	return s.notify(nil, method, params)
+}
+
+func (s *server) NotifyOthers(ctx context.Context, method string, params interface{}) error {
+	except, _ := ctx.Value(connKey{}).(*serverConn)
+	return s.notify(except, method, params)
+}
+
+// notify sends a notification to every connected peer but except, which may be nil.
+func (s *server) notify(except *serverConn, method string, params interface{}) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("could not marshal notification params: %w", err)
+	}
+	packet := mustMarshal(&notification{
+		ProtocolVersion: protocolVersion,
+		Method:          method,
+		Params:          rawParams,
+	})
+
+	s.Lock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for conn := range s.conns {
+		if conn != except {
+			conns = append(conns, conn)
+		}
+	}
+	s.Unlock()
+
+	for _, conn := range conns {
+		// A peer that has gone away will be cleaned up by its own read loop.
+		_ = conn.write(packet)
+	}
+	return nil
+}
+
+func (s *server) Serve(l net.Listener) error {
+	s.Lock()
+	s.listeners[l] = struct{}{}
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.listeners, l)
+		s.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+func (s *server) ServeConn(conn io.ReadWriteCloser) {
+	sc := &serverConn{conn: conn}
+
+	s.Lock()
+	s.conns[sc] = struct{}{}
+	s.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), connKey{}, sc))
+	defer cancel()
+	defer func() {
+		s.Lock()
+		delete(s.conns, sc)
+		s.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			if rsp := s.handlePacket(ctx, data); rsp != nil {
+				if err := sc.write(rsp); err != nil {
+					return
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *server) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	var err error
+	for l := range s.listeners {
+		if lerr := l.Close(); lerr != nil && err == nil {
+			err = lerr
+		}
+	}
+	for conn := range s.conns {
+		conn.conn.Close()
+	}
+	return err
+}
+
+// handlePacket handles a single inbound line, which may be one message or a batch.
+// It returns the packet to send back, or nil if there is nothing to send.
+func (s *server) handlePacket(ctx context.Context, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+
+	if data[0] != '[' {
+		rsp := s.handleMessage(ctx, data)
+		if rsp == nil {
+			return nil
+		}
+		return mustMarshal(rsp)
+	}
+
+	var messages []json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return mustMarshal(errorResponse(nil, CodeParseError, err.Error()))
+	}
+	if len(messages) == 0 {
+		return mustMarshal(errorResponse(nil, CodeInvalidRequest, "empty batch"))
+	}
+
+	var rsps []*serverResponse
+	for _, message := range messages {
+		if rsp := s.handleMessage(ctx, message); rsp != nil {
+			rsps = append(rsps, rsp)
+		}
+	}
+	if len(rsps) == 0 {
+		// A batch of only notifications gets no response.
+		return nil
+	}
+	return mustMarshal(rsps)
+}
+
+// handleMessage handles a single request or notification.
+// It returns nil for notifications, which get no response.
+func (s *server) handleMessage(ctx context.Context, data []byte) *serverResponse {
+	req := serverRequest{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errorResponse(nil, CodeParseError, err.Error())
+	}
+	if req.ProtocolVersion != protocolVersion || req.Method == "" {
+		return errorResponse(req.ID, CodeInvalidRequest, "invalid request")
+	}
+
+	result, err := s.call(ctx, req.Method, req.Params)
+	if req.ID == nil {
+		if err != nil {
+			log.Printf("could not handle notification %s: %v", req.Method, err)
+		}
+		return nil
+	}
+
+	if err != nil {
+		var remoteErr RemoteError
+		if errors.As(err, &remoteErr) {
+			return errorResponse(req.ID, remoteErr.Code, remoteErr.Message)
+		}
+		return errorResponse(req.ID, CodeInternalError, err.Error())
+	}
+
+	return &serverResponse{
+		ProtocolVersion: protocolVersion,
+		ID:              req.ID,
+		Result:          result,
+	}
+}
+
+func (s *server) call(ctx context.Context, method string, rawParams json.RawMessage) (json.RawMessage, error) {
+	s.Lock()
+	h, ok := s.methods[method]
+	s.Unlock()
+	if !ok {
+		return nil, RemoteError{
+			Code:    CodeMethodNotFound,
+			Message: fmt.Sprintf("method not found: %s", method),
+		}
+	}
+
+	params := reflect.New(h.params)
+	if len(rawParams) > 0 {
+		if err := json.Unmarshal(rawParams, params.Interface()); err != nil {
+			return nil, RemoteError{
+				Code:    CodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			}
+		}
+	}
+
+	out, err := invokeHandler(ctx, method, h, params.Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal result: %w", err)
+	}
+	return result, nil
+}
+
+// invokeHandler calls a method's handler, turning a panic into an internal error so that one bad request doesn't take down the connection.
+func invokeHandler(ctx context.Context, method string, h handler, params reflect.Value) (out interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("handler for %s panicked: %v", method, r)
+			out, err = nil, RemoteError{
+				Code:    CodeInternalError,
+				Message: "internal error",
+			}
+		}
+	}()
+
+	outs := h.fn.Call([]reflect.Value{reflect.ValueOf(ctx), params})
+	if err, _ := outs[1].Interface().(error); err != nil {
+		return nil, err
+	}
+	return outs[0].Interface(), nil
+}
+
+func (sc *serverConn) write(packet []byte) error {
+	sc.Lock()
+	defer sc.Unlock()
+
+	packet = append(packet, []byte("\r\n")...)
+	_, err := sc.conn.Write(packet)
+	return err
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *serverResponse {
+	return &serverResponse{
+		ProtocolVersion: protocolVersion,
+		ID:              id,
+		Error: &responseError{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("could not marshal %T: %v", v, err))
+	}
+	return data
+}
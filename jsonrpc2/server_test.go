@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type addParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+// newTestServer returns a Server with an "add" method, a "fail" method that returns a RemoteError, and a "panic" method that panics.
+func newTestServer(t *testing.T) Server {
+	t.Helper()
+
+	s := NewServer()
+	if err := s.Register("add", func(_ context.Context, p addParams) (int, error) {
+		return p.A + p.B, nil
+	}); err != nil {
+		t.Fatalf("could not register add: %v", err)
+	}
+	if err := s.Register("fail", func(_ context.Context, _ struct{}) (struct{}, error) {
+		return struct{}{}, RemoteError{Code: 42, Message: "failed"}
+	}); err != nil {
+		t.Fatalf("could not register fail: %v", err)
+	}
+	if err := s.Register("panic", func(_ context.Context, _ struct{}) (struct{}, error) {
+		panic("oops")
+	}); err != nil {
+		t.Fatalf("could not register panic: %v", err)
+	}
+	return s
+}
+
+// newTestClient returns a Client connected to s over a pipe, and a func to close them both.
+func newTestClient(s Server, opts ClientOptions) (Client, func()) {
+	serverConn, clientConn := net.Pipe()
+	go s.ServeConn(serverConn)
+
+	c := NewClientWithOptions(clientConn, opts)
+	return c, func() {
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s := NewServer()
+
+	for _, f := range []interface{}{
+		"not a func",
+		func(context.Context) (int, error) { return 0, nil },
+		func(int, int) (int, error) { return 0, nil },
+		func(context.Context, int) (int, int) { return 0, 0 },
+	} {
+		if err := s.Register("bad", f); err == nil {
+			t.Errorf("Register(%T) returned nil error, want error", f)
+		}
+	}
+}
+
+func TestServerCall(t *testing.T) {
+	c, done := newTestClient(newTestServer(t), ClientOptions{})
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var sum int
+	if err := c.Call(ctx, "add", addParams{A: 1, B: 2}, &sum); err != nil {
+		t.Fatalf("Call(add) returned error: %v", err)
+	}
+	if sum != 3 {
+		t.Errorf("Call(add) = %d, want 3", sum)
+	}
+
+	tests := []struct {
+		method   string
+		params   interface{}
+		wantCode int
+	}{
+		{"missing", nil, CodeMethodNotFound},
+		{"add", "not an object", CodeInvalidParams},
+		{"fail", nil, 42},
+		{"panic", nil, CodeInternalError},
+	}
+	for _, tt := range tests {
+		err := c.Call(ctx, tt.method, tt.params, nil)
+
+		var remoteErr RemoteError
+		if !errors.As(err, &remoteErr) {
+			t.Errorf("Call(%s, %v) returned %v, want RemoteError", tt.method, tt.params, err)
+			continue
+		}
+		if remoteErr.Code != tt.wantCode {
+			t.Errorf("Call(%s, %v) returned code %d, want %d", tt.method, tt.params, remoteErr.Code, tt.wantCode)
+		}
+	}
+
+	// The connection must survive a panicking handler.
+	if err := c.Call(ctx, "add", addParams{A: 2, B: 2}, &sum); err != nil || sum != 4 {
+		t.Errorf("Call(add) after a panic = %d, %v, want 4, nil", sum, err)
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	s := newTestServer(t).(*server)
+
+	tests := []struct {
+		name   string
+		packet string
+		want   []serverResponse
+	}{
+		{
+			name:   "requests and a notification",
+			packet: `[{"jsonrpc":"2.0","id":1,"method":"add","params":{"a":1,"b":2}},{"jsonrpc":"2.0","method":"add","params":{"a":3,"b":4}},{"jsonrpc":"2.0","id":2,"method":"missing"}]`,
+			want: []serverResponse{
+				{ProtocolVersion: "2.0", ID: json.RawMessage("1"), Result: json.RawMessage("3")},
+				{ProtocolVersion: "2.0", ID: json.RawMessage("2"), Error: &responseError{Code: CodeMethodNotFound, Message: "method not found: missing"}},
+			},
+		},
+		{
+			name:   "only notifications",
+			packet: `[{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2}}]`,
+			want:   nil,
+		},
+		{
+			name:   "empty",
+			packet: `[]`,
+			want: []serverResponse{
+				{ProtocolVersion: "2.0", ID: json.RawMessage("null"), Error: &responseError{Code: CodeInvalidRequest, Message: "empty batch"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := s.handlePacket(context.Background(), []byte(tt.packet))
+			if tt.want == nil {
+				if packet != nil {
+					t.Errorf("got response %s, want none", packet)
+				}
+				return
+			}
+
+			var got []serverResponse
+			if packet[0] != '[' {
+				got = make([]serverResponse, 1)
+				err := json.Unmarshal(packet, &got[0])
+				if err != nil {
+					t.Fatalf("could not unmarshal response %s: %v", packet, err)
+				}
+			} else if err := json.Unmarshal(packet, &got); err != nil {
+				t.Fatalf("could not unmarshal response %s: %v", packet, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got responses %s, want %+v", packet, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerNotifyOthers(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.Register("touch", func(ctx context.Context, _ struct{}) (struct{}, error) {
+		return struct{}{}, s.NotifyOthers(ctx, "touched", nil)
+	}); err != nil {
+		t.Fatalf("could not register touch: %v", err)
+	}
+
+	requester, done := newTestClient(s, ClientOptions{})
+	defer done()
+	other, otherDone := newTestClient(s, ClientOptions{})
+	defer otherDone()
+
+	// Notifications are delivered in order, so the requester must see "done" without first seeing "touched".
+	requesterGot := make(chan string, 2)
+	requester.Subscribe(AllMethods, func(method string, _ json.RawMessage) { requesterGot <- method })
+	otherGot := make(chan string, 2)
+	other.Subscribe(AllMethods, func(method string, _ json.RawMessage) { otherGot <- method })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// A call ensures the server has registered the other peer's connection before it is notified.
+	var sum int
+	if err := other.Call(ctx, "add", addParams{A: 1, B: 1}, &sum); err != nil {
+		t.Fatalf("Call(add) returned error: %v", err)
+	}
+
+	if err := requester.Call(ctx, "touch", nil, nil); err != nil {
+		t.Fatalf("Call(touch) returned error: %v", err)
+	}
+	if err := s.Notify("done", nil); err != nil {
+		t.Fatalf("Notify(done) returned error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		got  chan string
+		want string
+	}{
+		{"requester", requesterGot, "done"},
+		{"other peer", otherGot, "touched"},
+	} {
+		select {
+		case got := <-tt.got:
+			if got != tt.want {
+				t.Errorf("%s was first notified of %s, want %s", tt.name, got, tt.want)
+			}
+		case <-ctx.Done():
+			t.Errorf("%s was not notified", tt.name)
+		}
+	}
+}
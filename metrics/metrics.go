@@ -0,0 +1,236 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// Package metrics is a minimal Prometheus metrics registry, exported in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// Registry is a set of metrics.
+	Registry struct {
+		mu      sync.Mutex
+		metrics []*metric
+	}
+
+	// Counter is a metric that only goes up.
+	Counter struct{ *metric }
+
+	// Gauge is a metric that can go up and down.
+	Gauge struct{ *metric }
+
+	// Histogram is a metric that counts observations into buckets.
+	Histogram struct{ *metric }
+
+	metric struct {
+		mu sync.Mutex
+
+		name       string
+		help       string
+		kind       string
+		labelNames []string
+		buckets    []float64
+
+		series map[string]*series
+	}
+
+	series struct {
+		labelValues []string
+
+		value float64
+
+		// For histograms.
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+)
+
+var (
+	// DefaultBuckets are histogram buckets suited to network latencies, in seconds.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers and returns a new Counter.
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", labelNames, nil)}
+}
+
+// Gauge registers and returns a new Gauge.
+func (r *Registry) Gauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", labelNames, nil)}
+}
+
+// Histogram registers and returns a new Histogram with the given bucket upper bounds.
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(name, help, "histogram", labelNames, buckets)}
+}
+
+func (r *Registry) register(name, help, kind string, labelNames []string, buckets []float64) *metric {
+	m := &metric{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     map[string]*series{},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]*metric{}, r.metrics...)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		m.writeTo(&b)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Inc adds 1 to the Counter for the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the Counter for the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Set sets the Gauge for the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(s *series) { s.value = v })
+}
+
+// Reset removes every series from the Gauge, e.g. before setting it afresh from a new snapshot.
+func (g *Gauge) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series = map[string]*series{}
+}
+
+// Observe records an observation in the Histogram for the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.update(labelValues, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.buckets))
+		}
+		for i, upper := range h.buckets {
+			if v <= upper {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.sum += v
+	})
+}
+
+func (m *metric) update(labelValues []string, f func(*series)) {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metric %s has labels %v, got values %v", m.name, m.labelNames, labelValues))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		m.series[key] = s
+	}
+	f(s)
+}
+
+func (m *metric) writeTo(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", m.name, escape(m.help, false))
+	fmt.Fprintf(b, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n", m.name, m.labels(s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+		for i, upper := range m.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labels(s.labelValues, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labels(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", m.name, m.labels(s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", m.name, m.labels(s.labelValues, "", ""), s.count)
+	}
+}
+
+func (m *metric) labels(values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range m.labelNames {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escape(values[i], true)))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/jsonrpc2"
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+// Peers, for Reconnects.
+const (
+	MQTT       = "mqtt"
+	Snapserver = "snapserver"
+)
+
+// Outcomes, for RPCCalls and MQTTPublishes.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+var (
+	// Default is the registry of the metrics below.
+	Default = NewRegistry()
+
+	RPCCalls       = Default.Counter("catbus_snapcast_rpc_calls_total", "Snapserver RPC calls by method and outcome.", "method", "outcome")
+	RPCDuration    = Default.Histogram("catbus_snapcast_rpc_call_duration_seconds", "Snapserver RPC call latency by method.", DefaultBuckets, "method")
+	Notifications  = Default.Counter("catbus_snapcast_notifications_total", "Snapserver notifications by method.", "method")
+	MQTTPublishes  = Default.Counter("catbus_snapcast_mqtt_publishes_total", "MQTT publishes by outcome.", "outcome")
+	Reconnects     = Default.Counter("catbus_snapcast_reconnects_total", "Reconnections after the first connection, by peer.", "peer")
+	SpeakersOnline = Default.Gauge("catbus_snapcast_speakers_connected", "Number of speakers connected to the Snapserver.")
+	SpeakerOnline  = Default.Gauge("catbus_snapcast_speaker_connected", "Whether a speaker is connected (1) or not (0).", "group", "speaker")
+	SpeakerVolume  = Default.Gauge("catbus_snapcast_speaker_volume_percent", "Speaker volume, or 0 if muted.", "group", "speaker")
+)
+
+// CallInterceptor records RPCCalls and RPCDuration.
+func CallInterceptor(ctx context.Context, method string, params interface{}, result interface{}, next jsonrpc2.Invoker) error {
+	start := time.Now()
+	err := next(ctx, method, params, result)
+	RPCDuration.Observe(time.Since(start).Seconds(), method)
+
+	outcome := Success
+	if err != nil {
+		outcome = Failure
+	}
+	RPCCalls.Inc(method, outcome)
+	return err
+}
+
+// NotificationInterceptor records Notifications.
+func NotificationInterceptor(method string, payload json.RawMessage, next func(string, json.RawMessage)) {
+	Notifications.Inc(method)
+	next(method, payload)
+}
+
+// ClientOptions returns JSON-RPC client options that record Snapserver metrics.
+func ClientOptions() jsonrpc2.ClientOptions {
+	return jsonrpc2.ClientOptions{
+		CallInterceptors:         []jsonrpc2.CallInterceptor{CallInterceptor},
+		NotificationInterceptors: []jsonrpc2.NotificationInterceptor{NotificationInterceptor},
+	}
+}
+
+// ObserveGroups sets the speaker gauges from a snapshot of the Snapserver's groups.
+func ObserveGroups(groups map[string]snapcast.Group) {
+	SpeakerOnline.Reset()
+	SpeakerVolume.Reset()
+
+	online := 0
+	for _, group := range groups {
+		name := group.Name
+		if name == "" {
+			name = group.ID
+		}
+		for _, speaker := range group.Speakers {
+			connected, volume := 0.0, float64(speaker.Volume.Percent)
+			if speaker.Connected {
+				connected = 1
+				online++
+			}
+			if speaker.Volume.Muted {
+				volume = 0
+			}
+			SpeakerOnline.Set(connected, name, speaker.ID)
+			SpeakerVolume.Set(volume, name, speaker.ID)
+		}
+	}
+	SpeakersOnline.Set(float64(online))
+}
@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// Package scenes saves and restores whole Snapserver arrangements:
+// which speakers are grouped together, what each group plays, and each speaker's volume, mute, and latency.
+//
+// Scenes are stored as JSON files in a directory, one per scene, named after the scene.
+package scenes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+type (
+	// Scene is a saved Snapserver arrangement.
+	Scene struct {
+		Name   string  `json:"name"`
+		Groups []Group `json:"groups"`
+	}
+
+	// Group is a group of speakers in a Scene.
+	Group struct {
+		Name     string            `json:"name,omitempty"`
+		Stream   snapcast.StreamID `json:"stream"`
+		Speakers []Speaker         `json:"speakers"`
+	}
+
+	// Speaker is a speaker's settings in a Scene.
+	Speaker struct {
+		ID      string `json:"id"`
+		Name    string `json:"name,omitempty"`
+		Volume  int    `json:"volume"`
+		Muted   bool   `json:"muted"`
+		Latency int    `json:"latency"`
+	}
+)
+
+const extension = ".json"
+
+// Snapshot returns the Snapserver's current arrangement as a Scene.
+func Snapshot(ctx context.Context, client snapcast.Client, name string) (Scene, error) {
+	groups, err := client.Groups(ctx)
+	if err != nil {
+		return Scene{}, fmt.Errorf("could not get groups: %w", err)
+	}
+
+	// Sort groups by ID so that saving the same arrangement twice produces the same file.
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	scene := Scene{Name: name}
+	for _, id := range ids {
+		group := groups[id]
+		g := Group{
+			Name:   group.Name,
+			Stream: group.Stream,
+		}
+		for _, speaker := range group.Speakers {
+			g.Speakers = append(g.Speakers, Speaker{
+				ID:      speaker.ID,
+				Name:    speaker.Name,
+				Volume:  speaker.Volume.Percent,
+				Muted:   speaker.Volume.Muted,
+				Latency: speaker.Latency,
+			})
+		}
+		scene.Groups = append(scene.Groups, g)
+	}
+	return scene, nil
+}
+
+// Restore arranges the Snapserver as in the Scene.
+// Speakers the Snapserver does not know are skipped, and speakers the Scene does not mention are left as they are.
+func Restore(ctx context.Context, client snapcast.Client, scene Scene) error {
+	groups, err := client.Groups(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get groups: %w", err)
+	}
+	known := map[string]bool{}
+	for _, group := range groups {
+		for _, speaker := range group.Speakers {
+			known[speaker.ID] = true
+		}
+	}
+
+	var wanted []snapcast.Group
+	for _, g := range scene.Groups {
+		group := snapcast.Group{
+			Name:   g.Name,
+			Stream: g.Stream,
+		}
+		for _, speaker := range g.Speakers {
+			if !known[speaker.ID] {
+				log.Printf("skipping unknown speaker %v in scene %q", speaker.ID, scene.Name)
+				continue
+			}
+			group.Speakers = append(group.Speakers, snapcast.Speaker{
+				ID:      speaker.ID,
+				Name:    speaker.Name,
+				Volume:  snapcast.Volume{Percent: speaker.Volume, Muted: speaker.Muted},
+				Latency: speaker.Latency,
+			})
+		}
+		if len(group.Speakers) > 0 {
+			wanted = append(wanted, group)
+		}
+	}
+
+	if err := client.SetGroups(ctx, wanted); err != nil {
+		return fmt.Errorf("could not restore scene %q: %w", scene.Name, err)
+	}
+	return nil
+}
+
+// Save writes a Scene to dir, replacing any scene of the same name.
+func Save(dir string, scene Scene) error {
+	path, err := scenePath(dir, scene.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(scene, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal scene: %w", err)
+	}
+
+	// Write to a temporary file and rename it, so that a scene file is never half-written.
+	f, err := ioutil.TempFile(dir, ".scene-")
+	if err != nil {
+		return fmt.Errorf("could not create scene file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write scene file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write scene file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not write scene file: %w", err)
+	}
+	return nil
+}
+
+// Load reads the named Scene from dir.
+func Load(dir, name string) (Scene, error) {
+	path, err := scenePath(dir, name)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Scene{}, fmt.Errorf("could not read scene %q: %w", name, err)
+	}
+
+	scene := Scene{}
+	if err := json.Unmarshal(data, &scene); err != nil {
+		return Scene{}, fmt.Errorf("could not parse scene %q: %w", name, err)
+	}
+	scene.Name = name
+	return scene, nil
+}
+
+// List returns the names of the Scenes in dir, sorted.
+func List(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list scenes: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != extension {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(name, extension))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// scenePath returns the path of a named Scene's file in dir.
+func scenePath(dir, name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid scene name %q", name)
+	}
+	return filepath.Join(dir, name+extension), nil
+}
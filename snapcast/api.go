@@ -24,9 +24,30 @@ type (
 		// SetGroupStream sets a given Group's stream to the given Stream.
 		SetGroupStream(ctx context.Context, groupID string, stream StreamID) error
 
+		// SetGroupMute mutes or unmutes a given Group as a whole, leaving its speakers' own mutes alone.
+		SetGroupMute(ctx context.Context, groupID string, muted bool) error
+
+		// SetSpeakerVolume sets a given Speaker's volume and mute.
+		SetSpeakerVolume(ctx context.Context, speakerID string, volume Volume) error
+
+		// SetSpeakerLatency sets a given Speaker's latency, in milliseconds.
+		SetSpeakerLatency(ctx context.Context, speakerID string, latency int) error
+
+		// SetGroupSpeakers sets which speakers are in a given Group, and returns the resulting groups.
+		// Speakers moved into the group leave their old groups, and speakers moved out get groups of their own.
+		SetGroupSpeakers(ctx context.Context, groupID string, speakerIDs []string) (map[string]Group, error)
+
+		// SetGroups arranges the Snapserver's speakers into the given groups, then sets each group's stream and each speaker's volume and latency.
+		// Group IDs are ignored, as the Snapserver assigns them as speakers move.
+		// Streams, volumes, and latencies are set in a single batch.
+		SetGroups(ctx context.Context, groups []Group) error
+
 		// SetGroupStreamChangedHandler sets the handler that is called when a group's stream changes.
 		SetGroupStreamChangedHandler(func(groupID string, stream StreamID))
 
+		// SetSpeakerVolumeChangedHandler sets the handler that is called when a speaker's volume or mute changes.
+		SetSpeakerVolumeChangedHandler(func(speakerID string, volume Volume))
+
 		// Wait blocks until the connection fails.
 		Wait() error
 
@@ -39,15 +60,21 @@ type (
 		ID     string
 		Name   string
 		Stream StreamID
+		Muted  bool
 
 		Speakers []Speaker
 	}
 
 	// Speaker represents a speaker / sink / Snapclient.
 	Speaker struct {
+		// ID is the Snapclient's ID, which identifies it in RPCs.
+		ID string
+		// Name is the Snapclient's configured name, or its hostname if it has none.
 		Name      string
 		Connected bool
 		Volume    Volume
+		// Latency is the speaker's additional latency, in milliseconds.
+		Latency int
 	}
 
 	// StreamID is a stream identifier.
@@ -64,6 +91,10 @@ type (
 		Percent int
 		Muted   bool
 	}
+
+	// Curve shapes a volume fade: it maps how far through the fade's duration it is, from 0 to 1,
+	// to how far through the change in volume it should be, from 0 to 1.
+	Curve func(float64) float64
 )
 
 const (
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sync"
 
 	"github.com/hashicorp/mdns"
 	"go.eth.moe/catbus-snapcast/jsonrpc2"
@@ -19,7 +20,10 @@ type (
 	client struct {
 		jsonrpc2.Client
 
-		groupStreamChangedHandler func(string, StreamID)
+		// mu guards the handlers, which may be set while notifications are being dispatched.
+		mu                          sync.Mutex
+		groupStreamChangedHandler   func(string, StreamID)
+		speakerVolumeChangedHandler func(string, Volume)
 	}
 )
 
@@ -27,7 +31,13 @@ const (
 	mdnsService = "_snapcast-jsonrpc._tcp"
 )
 
+// Discover finds a Snapserver via mDNS and returns a client connected to it.
 func Discover() (Client, error) {
+	return DiscoverWithOptions(jsonrpc2.ClientOptions{})
+}
+
+// DiscoverWithOptions finds a Snapserver via mDNS and returns a client connected to it, with the given JSON-RPC options.
+func DiscoverWithOptions(opts jsonrpc2.ClientOptions) (Client, error) {
 	ch := make(chan *mdns.ServiceEntry)
 	defer close(ch)
 
@@ -43,31 +53,59 @@ func Discover() (Client, error) {
 		return nil, fmt.Errorf("found no %s services", mdnsService)
 	}
 
-	addr := fmt.Sprintf("%v:%v", serviceEntry.AddrV4, serviceEntry.Port)
+	return Dial(fmt.Sprintf("%v:%v", serviceEntry.AddrV4, serviceEntry.Port), opts)
+}
+
+// Dial connects to the Snapserver JSON-RPC interface at addr, with the given JSON-RPC options.
+func Dial(addr string, opts jsonrpc2.ClientOptions) (Client, error) {
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
-	return NewClient(conn), nil
+	return NewClientWithOptions(conn, opts), nil
 }
 
 // NewClient returns a Snapcast Snapserver client.
 func NewClient(conn net.Conn) Client {
+	return NewClientWithOptions(conn, jsonrpc2.ClientOptions{})
+}
+
+// NewClientWithOptions returns a Snapcast Snapserver client, with the given JSON-RPC options.
+func NewClientWithOptions(conn net.Conn, opts jsonrpc2.ClientOptions) Client {
 	c := &client{
-		Client: jsonrpc2.NewClient(conn),
-	}
-
-	c.SetNotificationHandler(func(method string, payload json.RawMessage) {
-		switch method {
-		case groupStreamChanged:
-			if c.groupStreamChangedHandler != nil {
-				rsp := &groupStreamChangedNotification{}
-				if err := json.Unmarshal(payload, rsp); err != nil {
-					log.Printf("could not unmarshal %s notification: %v", groupStreamChanged, err)
-					return
-				}
-				c.groupStreamChangedHandler(rsp.ID, rsp.Stream)
+		Client: jsonrpc2.NewClientWithOptions(conn, opts),
+	}
+
+	c.Subscribe(groupStreamChanged, func(_ string, payload json.RawMessage) {
+		c.mu.Lock()
+		handler := c.groupStreamChangedHandler
+		c.mu.Unlock()
+
+		if handler != nil {
+			rsp := &groupStreamChangedNotification{}
+			if err := json.Unmarshal(payload, rsp); err != nil {
+				log.Printf("could not unmarshal %s notification: %v", groupStreamChanged, err)
+				return
+			}
+			handler(rsp.ID, rsp.Stream)
+		}
+	})
+
+	c.Subscribe(clientVolumeChanged, func(_ string, payload json.RawMessage) {
+		c.mu.Lock()
+		handler := c.speakerVolumeChangedHandler
+		c.mu.Unlock()
+
+		if handler != nil {
+			rsp := &clientVolumeChangedNotification{}
+			if err := json.Unmarshal(payload, rsp); err != nil {
+				log.Printf("could not unmarshal %s notification: %v", clientVolumeChanged, err)
+				return
 			}
+			handler(rsp.ID, Volume{
+				Percent: rsp.Volume.Percent,
+				Muted:   rsp.Volume.Muted,
+			})
 		}
 	})
 
@@ -75,9 +113,17 @@ func NewClient(conn net.Conn) Client {
 }
 
 func (c *client) SetGroupStreamChangedHandler(f func(string, StreamID)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.groupStreamChangedHandler = f
 }
 
+func (c *client) SetSpeakerVolumeChangedHandler(f func(string, Volume)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.speakerVolumeChangedHandler = f
+}
+
 func (c *client) Host(ctx context.Context) (string, error) {
 	rsp := serverGetStatusResponse{}
 	if err := c.Call(ctx, serverGetStatus, nil, &rsp); err != nil {
@@ -97,28 +143,38 @@ func (c *client) Groups(ctx context.Context) (map[string]Group, error) {
 	if err := c.Call(ctx, serverGetStatus, nil, &rsp); err != nil {
 		return nil, fmt.Errorf("could not get server status: %w", err)
 	}
+	return groupsFromStatus(rsp), nil
+}
 
+func groupsFromStatus(rsp serverGetStatusResponse) map[string]Group {
 	groups := map[string]Group{}
 	for _, g := range rsp.Server.Groups {
 		var clients []Speaker
 		for _, c := range g.Clients {
+			name := c.Config.Name
+			if name == "" {
+				name = c.Host.Name
+			}
 			clients = append(clients, Speaker{
-				Name:      c.ID,
+				ID:        c.ID,
+				Name:      name,
 				Connected: c.Connected,
 				Volume: Volume{
 					Percent: c.Config.Volume.Percent,
 					Muted:   c.Config.Volume.Muted,
 				},
+				Latency: c.Config.Latency,
 			})
 		}
 		groups[g.ID] = Group{
 			ID:       g.ID,
 			Name:     g.Name,
 			Stream:   g.Stream,
+			Muted:    g.Muted,
 			Speakers: clients,
 		}
 	}
-	return groups, nil
+	return groups
 }
 
 func (c *client) Streams(ctx context.Context) ([]Stream, error) {
@@ -163,3 +219,121 @@ func (c *client) SetGroupStream(ctx context.Context, groupID string, stream Stre
 	}
 	return nil
 }
+
+func (c *client) SetGroupMute(ctx context.Context, groupID string, muted bool) error {
+	req := groupSetMuteRequest{
+		ID:   groupID,
+		Mute: muted,
+	}
+	rsp := groupSetMuteResponse{}
+	if err := c.Call(ctx, groupSetMute, req, &rsp); err != nil {
+		return fmt.Errorf("could not set group mute: %w", err)
+	}
+	if rsp.Mute != muted {
+		return fmt.Errorf("tried to set group mute to %v, but got %v instead", muted, rsp.Mute)
+	}
+	return nil
+}
+
+func (c *client) SetSpeakerVolume(ctx context.Context, speakerID string, v Volume) error {
+	req := clientSetVolumeRequest{
+		ID: speakerID,
+		Volume: volume{
+			Percent: v.Percent,
+			Muted:   v.Muted,
+		},
+	}
+	rsp := clientSetVolumeResponse{}
+	if err := c.Call(ctx, clientSetVolume, req, &rsp); err != nil {
+		return fmt.Errorf("could not set volume: %w", err)
+	}
+	return nil
+}
+
+func (c *client) SetSpeakerLatency(ctx context.Context, speakerID string, latency int) error {
+	req := clientSetLatencyRequest{
+		ID:      speakerID,
+		Latency: latency,
+	}
+	rsp := clientSetLatencyResponse{}
+	if err := c.Call(ctx, clientSetLatency, req, &rsp); err != nil {
+		return fmt.Errorf("could not set latency: %w", err)
+	}
+	return nil
+}
+
+func (c *client) SetGroupSpeakers(ctx context.Context, groupID string, speakerIDs []string) (map[string]Group, error) {
+	req := groupSetClientsRequest{
+		ID:      groupID,
+		Clients: speakerIDs,
+	}
+	// Group.SetClients responds with the whole server status.
+	rsp := serverGetStatusResponse{}
+	if err := c.Call(ctx, groupSetClients, req, &rsp); err != nil {
+		return nil, fmt.Errorf("could not set group speakers: %w", err)
+	}
+	return groupsFromStatus(rsp), nil
+}
+
+func (c *client) SetGroups(ctx context.Context, wanted []Group) error {
+	groups, err := c.Groups(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Regrouping changes group IDs, so each wanted group is found by its first speaker, after the previous regrouping.
+	ids := make([]string, len(wanted))
+	for i, group := range wanted {
+		if len(group.Speakers) == 0 {
+			continue
+		}
+		groupID, ok := groupOf(groups, group.Speakers[0].ID)
+		if !ok {
+			return fmt.Errorf("could not find speaker %v", group.Speakers[0].ID)
+		}
+
+		speakerIDs := make([]string, len(group.Speakers))
+		for j, speaker := range group.Speakers {
+			speakerIDs[j] = speaker.ID
+		}
+		groups, err = c.SetGroupSpeakers(ctx, groupID, speakerIDs)
+		if err != nil {
+			return err
+		}
+		ids[i] = groupID
+	}
+
+	batch := c.Batch()
+	for i, group := range wanted {
+		if ids[i] == "" {
+			continue
+		}
+		batch.Call(groupSetStream, groupSetStreamRequest{ID: ids[i], Stream: group.Stream}, nil)
+		for _, speaker := range group.Speakers {
+			batch.Call(clientSetVolume, clientSetVolumeRequest{
+				ID: speaker.ID,
+				Volume: volume{
+					Percent: speaker.Volume.Percent,
+					Muted:   speaker.Volume.Muted,
+				},
+			}, nil)
+			batch.Call(clientSetLatency, clientSetLatencyRequest{ID: speaker.ID, Latency: speaker.Latency}, nil)
+		}
+	}
+	if err := batch.Send(ctx); err != nil {
+		return fmt.Errorf("could not set streams and volumes: %w", err)
+	}
+	return nil
+}
+
+// groupOf returns the ID of the group a speaker is in.
+func groupOf(groups map[string]Group, speakerID string) (string, bool) {
+	for id, group := range groups {
+		for _, speaker := range group.Speakers {
+			if speaker.ID == speakerID {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package snapcast
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Curves for fades.
+var (
+	// Linear changes the volume at a constant rate.
+	Linear Curve = func(t float64) float64 { return t }
+	// EaseIn starts slowly and speeds up.
+	EaseIn Curve = func(t float64) float64 { return t * t }
+	// EaseOut starts quickly and slows down.
+	EaseOut Curve = func(t float64) float64 { return 1 - (1-t)*(1-t) }
+	// EaseInOut starts and ends slowly.
+	EaseInOut Curve = func(t float64) float64 { return (1 - math.Cos(math.Pi*t)) / 2 }
+)
+
+// Curves are the fade curves by name.
+var Curves = map[string]Curve{
+	"linear":      Linear,
+	"ease-in":     EaseIn,
+	"ease-out":    EaseOut,
+	"ease-in-out": EaseInOut,
+}
+
+// fadeInterval is how often a fade steps the volume.
+const fadeInterval = 200 * time.Millisecond
+
+// FadeSpeaker ramps a speaker's volume from its current percentage to target over d, following curve.
+// Mute is left as it is.
+// It returns early with ctx's error if ctx is done, leaving the volume where the fade had got to.
+func FadeSpeaker(ctx context.Context, client Client, speakerID string, target int, d time.Duration, curve Curve) error {
+	groups, err := client.Groups(ctx)
+	if err != nil {
+		return err
+	}
+	groupID, ok := groupOf(groups, speakerID)
+	if !ok {
+		return fmt.Errorf("could not find speaker %v", speakerID)
+	}
+
+	var speaker Speaker
+	for _, s := range groups[groupID].Speakers {
+		if s.ID == speakerID {
+			speaker = s
+		}
+	}
+
+	return fade(ctx, speaker.Volume.Percent, target, d, curve, func(percent int) error {
+		return client.SetSpeakerVolume(ctx, speakerID, Volume{Percent: percent, Muted: speaker.Volume.Muted})
+	})
+}
+
+// FadeGroup ramps a group's volume from its current percentage to target over d, following curve,
+// scaling each speaker's volume proportionally as SetGroupVolume does.
+// Mute is left as it is.
+// It returns early with ctx's error if ctx is done, leaving the volumes where the fade had got to.
+func FadeGroup(ctx context.Context, client Client, groupID string, target int, d time.Duration, curve Curve) error {
+	groups, err := client.Groups(ctx)
+	if err != nil {
+		return err
+	}
+	group, ok := groups[groupID]
+	if !ok {
+		return fmt.Errorf("could not find group %v", groupID)
+	}
+
+	// Scale from where the speakers started, so that rounding does not accumulate.
+	current := group.Speakers
+	return fade(ctx, group.Volume(), target, d, curve, func(percent int) error {
+		want := group.ScaleVolume(percent)
+		if err := setSpeakerVolumes(ctx, client, current, want); err != nil {
+			return err
+		}
+		current = want
+		return nil
+	})
+}
+
+// fade calls set with each new percentage from from to target over d, following curve.
+func fade(ctx context.Context, from, target int, d time.Duration, curve Curve, set func(int) error) error {
+	if target < 0 || target > 100 {
+		return fmt.Errorf("volume must be between 0 and 100, not %d", target)
+	}
+	if curve == nil {
+		curve = Linear
+	}
+
+	current := from
+	step := func(t float64) error {
+		percent := from + int(math.Round(float64(target-from)*curve(t)))
+		if percent == current {
+			return nil
+		}
+		if err := set(percent); err != nil {
+			return err
+		}
+		current = percent
+		return nil
+	}
+
+	ticker := time.NewTicker(fadeInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= d {
+			return step(1)
+		}
+		if err := step(float64(elapsed) / float64(d)); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
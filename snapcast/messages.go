@@ -45,7 +45,7 @@ type (
 		ID      string         `json:"id"`
 		Name    string         `json:"name"`
 		Muted   bool           `json:"muted"`
-		Stream  StreamID         `json:"stream_id"`
+		Stream  StreamID       `json:"stream_id"`
 		Clients []clientStatus `json:"clients"`
 	}
 
@@ -125,13 +125,34 @@ type (
 	}
 
 	groupSetStreamRequest struct {
-		ID     string `json:"id"`
+		ID     string   `json:"id"`
 		Stream StreamID `json:"stream_id"`
 	}
 	groupSetStreamResponse struct {
 		Stream StreamID `json:"stream_id"`
 	}
 
+	clientSetLatencyRequest struct {
+		ID      string `json:"id"`
+		Latency int    `json:"latency"`
+	}
+	clientSetLatencyResponse struct {
+		Latency int `json:"latency"`
+	}
+
+	groupSetClientsRequest struct {
+		ID      string   `json:"id"`
+		Clients []string `json:"clients"`
+	}
+
+	groupSetMuteRequest struct {
+		ID   string `json:"id"`
+		Mute bool   `json:"mute"`
+	}
+	groupSetMuteResponse struct {
+		Mute bool `json:"mute"`
+	}
+
 	groupSetNameRequest struct {
 		ID   string `json:"id"`
 		Name string `json:"name"`
@@ -166,7 +187,7 @@ type (
 		Mute bool   `json:"mute"`
 	}
 	groupStreamChangedNotification struct {
-		ID     string `json:"id"`
+		ID     string   `json:"id"`
 		Stream StreamID `json:"stream_id"`
 	}
 	groupNameChangedNotification struct {
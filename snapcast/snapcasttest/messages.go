@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package snapcasttest
+
+import "go.eth.moe/catbus-snapcast/snapcast"
+
+type (
+	// common structs.
+
+	host struct {
+		IP   string `json:"ip,omitempty"`
+		Name string `json:"name"`
+	}
+
+	volume struct {
+		Muted   bool `json:"muted"`
+		Percent int  `json:"percent"`
+	}
+
+	clientConfig struct {
+		Name     string `json:"name"`
+		Instance int    `json:"instance"`
+		Latency  int    `json:"latency"`
+		Volume   volume `json:"volume"`
+	}
+
+	clientStatus struct {
+		ID        string       `json:"id"`
+		Connected bool         `json:"connected"`
+		Host      host         `json:"host"`
+		Config    clientConfig `json:"config"`
+	}
+
+	groupStatus struct {
+		ID      string            `json:"id"`
+		Name    string            `json:"name"`
+		Muted   bool              `json:"muted"`
+		Stream  snapcast.StreamID `json:"stream_id"`
+		Clients []*clientStatus   `json:"clients"`
+	}
+
+	streamStatus struct {
+		ID     snapcast.StreamID `json:"id"`
+		Status string            `json:"status"`
+	}
+
+	serverStatus struct {
+		Snapserver struct {
+			ProtocolVersion        int    `json:"protocolVersion"`
+			Version                string `json:"version"`
+			Name                   string `json:"name"`
+			ControlProtocolVersion int    `json:"controlProtocolVersion"`
+		} `json:"snapserver"`
+		Host host `json:"host"`
+	}
+
+	fullStatus struct {
+		Streams []*streamStatus `json:"streams"`
+		Groups  []*groupStatus  `json:"groups"`
+		Server  serverStatus    `json:"server"`
+	}
+
+	// RPC requests & responses.
+
+	serverGetRPCVersionResponse struct {
+		Major int `json:"major"`
+		Minor int `json:"minor"`
+		Patch int `json:"patch"`
+	}
+
+	serverGetStatusResponse struct {
+		Server fullStatus `json:"server"`
+	}
+
+	idRequest struct {
+		ID string `json:"id"`
+	}
+
+	clientGetStatusResponse struct {
+		Client clientStatus `json:"client"`
+	}
+
+	clientSetVolumeRequest struct {
+		ID     string `json:"id"`
+		Volume volume `json:"volume"`
+	}
+	clientSetVolumeResponse struct {
+		Volume volume `json:"volume"`
+	}
+
+	clientSetLatencyRequest struct {
+		ID      string `json:"id"`
+		Latency int    `json:"latency"`
+	}
+	clientSetLatencyResponse struct {
+		Latency int `json:"latency"`
+	}
+
+	clientSetNameRequest struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	clientSetNameResponse struct {
+		Name string `json:"name"`
+	}
+
+	groupGetStatusResponse struct {
+		Group groupStatus `json:"group"`
+	}
+
+	groupSetStreamRequest struct {
+		ID     string            `json:"id"`
+		Stream snapcast.StreamID `json:"stream_id"`
+	}
+	groupSetStreamResponse struct {
+		Stream snapcast.StreamID `json:"stream_id"`
+	}
+
+	groupSetMuteRequest struct {
+		ID   string `json:"id"`
+		Mute bool   `json:"mute"`
+	}
+	groupSetMuteResponse struct {
+		Mute bool `json:"mute"`
+	}
+
+	groupSetNameRequest struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	groupSetNameResponse struct {
+		Name string `json:"name"`
+	}
+
+	groupSetClientsRequest struct {
+		ID      string   `json:"id"`
+		Clients []string `json:"clients"`
+	}
+
+	clientConnectedNotification struct {
+		ID     string       `json:"id"`
+		Client clientStatus `json:"client"`
+	}
+	clientVolumeChangedNotification struct {
+		ID     string `json:"id"`
+		Volume volume `json:"volume"`
+	}
+	clientLatencyChangedNotification struct {
+		ID      string `json:"id"`
+		Latency int    `json:"latency"`
+	}
+	clientNameChangedNotification struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	groupMutedNotification struct {
+		ID   string `json:"id"`
+		Mute bool   `json:"mute"`
+	}
+	groupStreamChangedNotification struct {
+		ID     string            `json:"id"`
+		Stream snapcast.StreamID `json:"stream_id"`
+	}
+	groupNameChangedNotification struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+)
+
+// JSON-RPC method names.
+const (
+	clientGetStatus  = "Client.GetStatus"
+	clientSetLatency = "Client.SetLatency"
+	clientSetName    = "Client.SetName"
+	clientSetVolume  = "Client.SetVolume"
+
+	groupGetStatus  = "Group.GetStatus"
+	groupSetClients = "Group.SetClients"
+	groupSetMute    = "Group.SetMute"
+	groupSetName    = "Group.SetName"
+	groupSetStream  = "Group.SetStream"
+
+	serverGetRPCVersion = "Server.GetRPCVersion"
+	serverGetStatus     = "Server.GetStatus"
+
+	clientConnected      = "Client.OnConnect"
+	clientDisconnected   = "Client.OnDisconnect"
+	clientVolumeChanged  = "Client.OnVolumeChanged"
+	clientLatencyChanged = "Client.OnLatencyChanged"
+	clientNameChanged    = "Client.OnNameChanged"
+	groupMuted           = "Group.OnMute"
+	groupStreamChanged   = "Group.OnStreamChanged"
+	groupNameChanged     = "Group.OnNameChanged"
+	serverUpdated        = "Server.OnUpdate"
+)
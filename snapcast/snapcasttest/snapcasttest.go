@@ -0,0 +1,491 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+// Package snapcasttest provides a fake Snapserver for testing.
+//
+// The fake keeps an in-memory model of groups, speakers, and streams, answers the Snapcast JSON-RPC API against it, and sends the corresponding notifications.
+// Like a real Snapserver, a change is notified to every connected client except the one whose request made it.
+// Changes made through the Server's own methods are notified to every connected client.
+package snapcasttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"go.eth.moe/catbus-snapcast/jsonrpc2"
+	"go.eth.moe/catbus-snapcast/snapcast"
+)
+
+type (
+	// Server is a fake Snapserver listening on a loopback address.
+	Server struct {
+		mu sync.Mutex
+
+		rpc      jsonrpc2.Server
+		listener net.Listener
+
+		status fullStatus
+	}
+)
+
+// NewServer starts and returns a new fake Snapserver with no groups, speakers, or streams.
+// The caller should call Close when finished, to shut it down.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on loopback: %w", err)
+	}
+
+	s := &Server{
+		rpc:      jsonrpc2.NewServer(),
+		listener: listener,
+	}
+	s.status.Server.Snapserver.Name = "Snapserver"
+	s.status.Server.Snapserver.Version = "0.22.0"
+	s.status.Server.Snapserver.ProtocolVersion = 1
+	s.status.Server.Snapserver.ControlProtocolVersion = 1
+	s.status.Server.Host = host{
+		IP:   "127.0.0.1",
+		Name: "snapcasttest",
+	}
+
+	for method, handler := range map[string]interface{}{
+		serverGetRPCVersion: s.getRPCVersion,
+		serverGetStatus:     s.getStatus,
+
+		clientGetStatus:  s.getClientStatus,
+		clientSetLatency: s.setClientLatency,
+		clientSetName:    s.setClientName,
+		clientSetVolume:  s.setClientVolume,
+
+		groupGetStatus:  s.getGroupStatus,
+		groupSetClients: s.setGroupClients,
+		groupSetMute:    s.setGroupMute,
+		groupSetName:    s.setGroupName,
+		groupSetStream:  s.setGroupStream,
+	} {
+		if err := s.rpc.Register(method, handler); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("could not register %s: %w", method, err)
+		}
+	}
+
+	go s.rpc.Serve(listener)
+
+	return s, nil
+}
+
+// Addr returns the host:port the Server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Dial returns a new snapcast.Client connected to the Server.
+func (s *Server) Dial() (snapcast.Client, error) {
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		return nil, err
+	}
+	return snapcast.NewClient(conn), nil
+}
+
+// Close shuts down the Server and disconnects all clients.
+func (s *Server) Close() error {
+	return s.rpc.Close()
+}
+
+// AddStream adds a stream.
+func (s *Server) AddStream(stream snapcast.Stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Streams = append(s.status.Streams, &streamStatus{
+		ID:     stream.ID,
+		Status: stream.Status,
+	})
+}
+
+// AddGroup adds a group and its speakers.
+// A speaker's Name becomes its client's hostname.
+func (s *Server) AddGroup(group snapcast.Group) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := &groupStatus{
+		ID:     group.ID,
+		Name:   group.Name,
+		Stream: group.Stream,
+		Muted:  group.Muted,
+	}
+	for _, speaker := range group.Speakers {
+		g.Clients = append(g.Clients, &clientStatus{
+			ID:        speaker.ID,
+			Connected: speaker.Connected,
+			Host:      host{Name: speaker.Name},
+			Config: clientConfig{
+				Instance: 1,
+				Latency:  speaker.Latency,
+				Volume: volume{
+					Percent: speaker.Volume.Percent,
+					Muted:   speaker.Volume.Muted,
+				},
+			},
+		})
+	}
+	s.status.Groups = append(s.status.Groups, g)
+}
+
+// Groups returns a snapshot of the Server's groups by group ID.
+func (s *Server) Groups() map[string]snapcast.Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := map[string]snapcast.Group{}
+	for _, g := range s.status.Groups {
+		var speakers []snapcast.Speaker
+		for _, c := range g.Clients {
+			name := c.Config.Name
+			if name == "" {
+				name = c.Host.Name
+			}
+			speakers = append(speakers, snapcast.Speaker{
+				ID:        c.ID,
+				Name:      name,
+				Connected: c.Connected,
+				Volume: snapcast.Volume{
+					Percent: c.Config.Volume.Percent,
+					Muted:   c.Config.Volume.Muted,
+				},
+				Latency: c.Config.Latency,
+			})
+		}
+		groups[g.ID] = snapcast.Group{
+			ID:       g.ID,
+			Name:     g.Name,
+			Stream:   g.Stream,
+			Muted:    g.Muted,
+			Speakers: speakers,
+		}
+	}
+	return groups
+}
+
+// SetGroupStream changes a group's stream, as if another controller had, and notifies all clients.
+func (s *Server) SetGroupStream(groupID string, stream snapcast.StreamID) error {
+	_, err := s.setGroupStream(context.Background(), groupSetStreamRequest{
+		ID:     groupID,
+		Stream: stream,
+	})
+	return err
+}
+
+// SetSpeakerVolume changes a speaker's volume, as if another controller had, and notifies all clients.
+func (s *Server) SetSpeakerVolume(speakerID string, v snapcast.Volume) error {
+	_, err := s.setClientVolume(context.Background(), clientSetVolumeRequest{
+		ID: speakerID,
+		Volume: volume{
+			Percent: v.Percent,
+			Muted:   v.Muted,
+		},
+	})
+	return err
+}
+
+// SetSpeakerConnected connects or disconnects a speaker, and notifies all clients.
+func (s *Server) SetSpeakerConnected(speakerID string, connected bool) error {
+	s.mu.Lock()
+	c, _ := s.findClient(speakerID)
+	if c == nil {
+		s.mu.Unlock()
+		return clientNotFound(speakerID)
+	}
+	c.Connected = connected
+	noti := clientConnectedNotification{
+		ID:     c.ID,
+		Client: *c,
+	}
+	s.mu.Unlock()
+
+	method := clientConnected
+	if !connected {
+		method = clientDisconnected
+	}
+	return s.rpc.Notify(method, noti)
+}
+
+func (s *Server) getRPCVersion(_ context.Context, _ struct{}) (serverGetRPCVersionResponse, error) {
+	return serverGetRPCVersionResponse{Major: 2}, nil
+}
+
+func (s *Server) getStatus(_ context.Context, _ struct{}) (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return json.Marshal(serverGetStatusResponse{Server: s.status})
+}
+
+func (s *Server) getClientStatus(_ context.Context, req idRequest) (clientGetStatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, _ := s.findClient(req.ID)
+	if c == nil {
+		return clientGetStatusResponse{}, clientNotFound(req.ID)
+	}
+	return clientGetStatusResponse{Client: *c}, nil
+}
+
+func (s *Server) setClientLatency(ctx context.Context, req clientSetLatencyRequest) (clientSetLatencyResponse, error) {
+	s.mu.Lock()
+	c, _ := s.findClient(req.ID)
+	if c == nil {
+		s.mu.Unlock()
+		return clientSetLatencyResponse{}, clientNotFound(req.ID)
+	}
+	c.Config.Latency = req.Latency
+	s.mu.Unlock()
+
+	s.notify(ctx, clientLatencyChanged, clientLatencyChangedNotification{
+		ID:      req.ID,
+		Latency: req.Latency,
+	})
+	return clientSetLatencyResponse{Latency: req.Latency}, nil
+}
+
+func (s *Server) setClientName(ctx context.Context, req clientSetNameRequest) (clientSetNameResponse, error) {
+	s.mu.Lock()
+	c, _ := s.findClient(req.ID)
+	if c == nil {
+		s.mu.Unlock()
+		return clientSetNameResponse{}, clientNotFound(req.ID)
+	}
+	c.Config.Name = req.Name
+	s.mu.Unlock()
+
+	s.notify(ctx, clientNameChanged, clientNameChangedNotification{
+		ID:   req.ID,
+		Name: req.Name,
+	})
+	return clientSetNameResponse{Name: req.Name}, nil
+}
+
+func (s *Server) setClientVolume(ctx context.Context, req clientSetVolumeRequest) (clientSetVolumeResponse, error) {
+	s.mu.Lock()
+	c, _ := s.findClient(req.ID)
+	if c == nil {
+		s.mu.Unlock()
+		return clientSetVolumeResponse{}, clientNotFound(req.ID)
+	}
+	c.Config.Volume = req.Volume
+	s.mu.Unlock()
+
+	s.notify(ctx, clientVolumeChanged, clientVolumeChangedNotification{
+		ID:     req.ID,
+		Volume: req.Volume,
+	})
+	return clientSetVolumeResponse{Volume: req.Volume}, nil
+}
+
+func (s *Server) getGroupStatus(_ context.Context, req idRequest) (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.findGroup(req.ID)
+	if g == nil {
+		return nil, groupNotFound(req.ID)
+	}
+	return json.Marshal(groupGetStatusResponse{Group: *g})
+}
+
+func (s *Server) setGroupClients(ctx context.Context, req groupSetClientsRequest) (json.RawMessage, error) {
+	s.mu.Lock()
+	group := s.findGroup(req.ID)
+	if group == nil {
+		s.mu.Unlock()
+		return nil, groupNotFound(req.ID)
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range req.Clients {
+		if c, _ := s.findClient(id); c == nil {
+			s.mu.Unlock()
+			return nil, clientNotFound(id)
+		}
+		wanted[id] = true
+	}
+
+	// Clients leaving the group get a group of their own, and clients joining it leave their old one.
+	var groups []*groupStatus
+	var clients []*clientStatus
+	for _, g := range s.status.Groups {
+		var kept []*clientStatus
+		for _, c := range g.Clients {
+			switch {
+			case wanted[c.ID]:
+				clients = append(clients, c)
+			case g == group:
+				groups = append(groups, &groupStatus{
+					ID:      s.newGroupID(c.ID+"-group", groups),
+					Stream:  g.Stream,
+					Clients: []*clientStatus{c},
+				})
+			default:
+				kept = append(kept, c)
+			}
+		}
+		g.Clients = kept
+	}
+	group.Clients = clients
+	for _, g := range s.status.Groups {
+		if len(g.Clients) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	s.status.Groups = groups
+
+	// Marshal while locked, as the status holds pointers into the model.
+	rsp, err := json.Marshal(serverGetStatusResponse{Server: s.status})
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Server.GetStatus and Server.OnUpdate share a payload shape.
+	s.notify(ctx, serverUpdated, rsp)
+	return rsp, nil
+}
+
+func (s *Server) setGroupMute(ctx context.Context, req groupSetMuteRequest) (groupSetMuteResponse, error) {
+	s.mu.Lock()
+	g := s.findGroup(req.ID)
+	if g == nil {
+		s.mu.Unlock()
+		return groupSetMuteResponse{}, groupNotFound(req.ID)
+	}
+	g.Muted = req.Mute
+	s.mu.Unlock()
+
+	s.notify(ctx, groupMuted, groupMutedNotification{
+		ID:   req.ID,
+		Mute: req.Mute,
+	})
+	return groupSetMuteResponse{Mute: req.Mute}, nil
+}
+
+func (s *Server) setGroupName(ctx context.Context, req groupSetNameRequest) (groupSetNameResponse, error) {
+	s.mu.Lock()
+	g := s.findGroup(req.ID)
+	if g == nil {
+		s.mu.Unlock()
+		return groupSetNameResponse{}, groupNotFound(req.ID)
+	}
+	g.Name = req.Name
+	s.mu.Unlock()
+
+	s.notify(ctx, groupNameChanged, groupNameChangedNotification{
+		ID:   req.ID,
+		Name: req.Name,
+	})
+	return groupSetNameResponse{Name: req.Name}, nil
+}
+
+func (s *Server) setGroupStream(ctx context.Context, req groupSetStreamRequest) (groupSetStreamResponse, error) {
+	s.mu.Lock()
+	g := s.findGroup(req.ID)
+	if g == nil {
+		s.mu.Unlock()
+		return groupSetStreamResponse{}, groupNotFound(req.ID)
+	}
+	if !s.hasStream(req.Stream) {
+		s.mu.Unlock()
+		return groupSetStreamResponse{}, jsonrpc2.RemoteError{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("stream not found: %v", req.Stream),
+		}
+	}
+	g.Stream = req.Stream
+	s.mu.Unlock()
+
+	s.notify(ctx, groupStreamChanged, groupStreamChangedNotification{
+		ID:     req.ID,
+		Stream: req.Stream,
+	})
+	return groupSetStreamResponse{Stream: req.Stream}, nil
+}
+
+// findClient must be called with s.mu held.
+func (s *Server) findClient(id string) (*clientStatus, *groupStatus) {
+	for _, g := range s.status.Groups {
+		for _, c := range g.Clients {
+			if c.ID == id {
+				return c, g
+			}
+		}
+	}
+	return nil, nil
+}
+
+// findGroup must be called with s.mu held.
+func (s *Server) findGroup(id string) *groupStatus {
+	for _, g := range s.status.Groups {
+		if g.ID == id {
+			return g
+		}
+	}
+	return nil
+}
+
+// newGroupID returns base, or base with a numeric suffix, such that no existing group nor any of pending has it as its ID.
+// It must be called with s.mu held.
+func (s *Server) newGroupID(base string, pending []*groupStatus) string {
+	taken := func(id string) bool {
+		if s.findGroup(id) != nil {
+			return true
+		}
+		for _, g := range pending {
+			if g.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	id := base
+	for i := 2; taken(id); i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	return id
+}
+
+// hasStream must be called with s.mu held.
+func (s *Server) hasStream(id snapcast.StreamID) bool {
+	for _, stream := range s.status.Streams {
+		if stream.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) notify(ctx context.Context, method string, params interface{}) {
+	// The model has already changed, so a failed notification must not fail the request.
+	_ = s.rpc.NotifyOthers(ctx, method, params)
+}
+
+func clientNotFound(id string) error {
+	return jsonrpc2.RemoteError{
+		Code:    jsonrpc2.CodeInvalidParams,
+		Message: fmt.Sprintf("client not found: %v", id),
+	}
+}
+
+func groupNotFound(id string) error {
+	return jsonrpc2.RemoteError{
+		Code:    jsonrpc2.CodeInvalidParams,
+		Message: fmt.Sprintf("group not found: %v", id),
+	}
+}
@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package snapcasttest_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.eth.moe/catbus-snapcast/snapcast"
+	"go.eth.moe/catbus-snapcast/snapcast/snapcasttest"
+)
+
+// newServer returns a fake Snapserver with one group of two speakers, a client connected to it, and a func to close them both.
+func newServer(t *testing.T) (*snapcasttest.Server, snapcast.Client, func()) {
+	t.Helper()
+
+	s, err := snapcasttest.NewServer()
+	if err != nil {
+		t.Fatalf("could not start fake Snapserver: %v", err)
+	}
+
+	s.AddStream(snapcast.Stream{ID: "radio", Status: "playing"})
+	s.AddStream(snapcast.Stream{ID: "tv", Status: "idle"})
+	s.AddGroup(snapcast.Group{
+		ID:     "g1",
+		Name:   "Kitchen",
+		Stream: "radio",
+		Speakers: []snapcast.Speaker{
+			{ID: "s1", Name: "fridge", Connected: true, Volume: snapcast.Volume{Percent: 40}},
+			{ID: "s2", Name: "window", Connected: true, Volume: snapcast.Volume{Percent: 60}},
+		},
+	})
+
+	client, err := s.Dial()
+	if err != nil {
+		s.Close()
+		t.Fatalf("could not dial fake Snapserver: %v", err)
+	}
+
+	return s, client, func() {
+		client.Close()
+		s.Close()
+	}
+}
+
+func TestGroups(t *testing.T) {
+	_, client, done := newServer(t)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	got, err := client.Groups(ctx)
+	if err != nil {
+		t.Fatalf("Groups() returned error: %v", err)
+	}
+	want := map[string]snapcast.Group{
+		"g1": {
+			ID:     "g1",
+			Name:   "Kitchen",
+			Stream: "radio",
+			Speakers: []snapcast.Speaker{
+				{ID: "s1", Name: "fridge", Connected: true, Volume: snapcast.Volume{Percent: 40}},
+				{ID: "s2", Name: "window", Connected: true, Volume: snapcast.Volume{Percent: 60}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() = %+v, want %+v", got, want)
+	}
+
+	streams, err := client.Streams(ctx)
+	if err != nil {
+		t.Fatalf("Streams() returned error: %v", err)
+	}
+	wantStreams := []snapcast.Stream{{ID: "radio", Status: "playing"}, {ID: "tv", Status: "idle"}}
+	if !reflect.DeepEqual(streams, wantStreams) {
+		t.Errorf("Streams() = %+v, want %+v", streams, wantStreams)
+	}
+}
+
+// dialObserver returns a second client connected to s, which must be closed when finished.
+func dialObserver(t *testing.T, s *snapcasttest.Server) snapcast.Client {
+	t.Helper()
+
+	observer, err := s.Dial()
+	if err != nil {
+		t.Fatalf("could not dial fake Snapserver: %v", err)
+	}
+
+	// A call ensures the Server has registered the connection before anything is notified.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := observer.Host(ctx); err != nil {
+		observer.Close()
+		t.Fatalf("could not call fake Snapserver: %v", err)
+	}
+	return observer
+}
+
+func TestSetGroupStream(t *testing.T) {
+	s, client, done := newServer(t)
+	defer done()
+	observer := dialObserver(t, s)
+	defer observer.Close()
+
+	streamChanges := func(c snapcast.Client) chan snapcast.StreamID {
+		changes := make(chan snapcast.StreamID, 2)
+		c.SetGroupStreamChangedHandler(func(groupID string, stream snapcast.StreamID) {
+			if groupID == "g1" {
+				changes <- stream
+			}
+		})
+		return changes
+	}
+	requesterChanges := streamChanges(client)
+	observerChanges := streamChanges(observer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := client.SetGroupStream(ctx, "g1", "tv"); err != nil {
+		t.Fatalf("SetGroupStream(g1, tv) returned error: %v", err)
+	}
+	if got := s.Groups()["g1"].Stream; got != "tv" {
+		t.Errorf("group g1 has stream %v, want tv", got)
+	}
+
+	// A change made through the Server notifies every client, so the requester must see it without first seeing its own change.
+	if err := s.SetGroupStream("g1", "radio"); err != nil {
+		t.Fatalf("Server.SetGroupStream(g1, radio) returned error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		changes chan snapcast.StreamID
+		want    snapcast.StreamID
+	}{
+		{"requester", requesterChanges, "radio"},
+		{"observer", observerChanges, "tv"},
+	} {
+		select {
+		case got := <-tt.changes:
+			if got != tt.want {
+				t.Errorf("%s was first notified of stream %v, want %v", tt.name, got, tt.want)
+			}
+		case <-ctx.Done():
+			t.Errorf("%s was not notified of stream change", tt.name)
+		}
+	}
+
+	if err := client.SetGroupStream(ctx, "g1", "missing"); err == nil {
+		t.Error("SetGroupStream(g1, missing) returned nil error, want error")
+	}
+	if err := client.SetGroupStream(ctx, "missing", "tv"); err == nil {
+		t.Error("SetGroupStream(missing, tv) returned nil error, want error")
+	}
+}
+
+func TestSetSpeakerVolume(t *testing.T) {
+	s, client, done := newServer(t)
+	defer done()
+	observer := dialObserver(t, s)
+	defer observer.Close()
+
+	changes := make(chan snapcast.Volume, 1)
+	observer.SetSpeakerVolumeChangedHandler(func(speakerID string, volume snapcast.Volume) {
+		if speakerID == "s2" {
+			changes <- volume
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	want := snapcast.Volume{Percent: 25, Muted: true}
+	if err := client.SetSpeakerVolume(ctx, "s2", want); err != nil {
+		t.Fatalf("SetSpeakerVolume(s2) returned error: %v", err)
+	}
+	if got := s.Groups()["g1"].Speakers[1].Volume; got != want {
+		t.Errorf("speaker s2 has volume %+v, want %+v", got, want)
+	}
+
+	select {
+	case got := <-changes:
+		if got != want {
+			t.Errorf("notified of volume %+v, want %+v", got, want)
+		}
+	case <-ctx.Done():
+		t.Error("not notified of volume change")
+	}
+}
+
+// TestResetHandlers replaces the handlers while notifications are being dispatched, as the bridge does when it resyncs.
+// Run it with -race.
+func TestResetHandlers(t *testing.T) {
+	s, client, done := newServer(t)
+	defer done()
+
+	notified := make(chan struct{}, 1)
+	handler := func(string, snapcast.Volume) {
+		select {
+		case notified <- struct{}{}:
+		default:
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := s.SetSpeakerVolume("s1", snapcast.Volume{Percent: i}); err != nil {
+			t.Fatalf("SetSpeakerVolume(s1) returned error: %v", err)
+		}
+		client.SetSpeakerVolumeChangedHandler(handler)
+		client.SetGroupStreamChangedHandler(func(string, snapcast.StreamID) {})
+	}
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Error("not notified of volume changes")
+	}
+}
+
+func TestSetGroupSpeakers(t *testing.T) {
+	_, client, done := newServer(t)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Moving a speaker back and forth must never give two groups the same ID, nor lose a speaker.
+	steps := []struct {
+		groupID  string
+		speakers []string
+	}{
+		{"g1", []string{"s2"}},
+		{"s1-group", []string{"s1", "s2"}},
+		{"s1-group", []string{"s2"}},
+	}
+	for _, step := range steps {
+		if _, err := client.SetGroupSpeakers(ctx, step.groupID, step.speakers); err != nil {
+			t.Fatalf("SetGroupSpeakers(%v, %v) returned error: %v", step.groupID, step.speakers, err)
+		}
+	}
+
+	groups, err := client.Groups(ctx)
+	if err != nil {
+		t.Fatalf("Groups() returned error: %v", err)
+	}
+	var speakers []string
+	for _, group := range groups {
+		for _, speaker := range group.Speakers {
+			speakers = append(speakers, speaker.ID)
+		}
+	}
+	sort.Strings(speakers)
+	if want := []string{"s1", "s2"}; !reflect.DeepEqual(speakers, want) {
+		t.Errorf("speakers = %v, want %v", speakers, want)
+	}
+	if got := groups["s1-group"].Speakers; len(got) != 1 || got[0].ID != "s2" {
+		t.Errorf("group s1-group has speakers %+v, want only s2", got)
+	}
+}
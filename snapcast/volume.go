@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package snapcast
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Volume returns the group's volume, as Snapweb presents it: the mean of its speakers' volumes.
+func (g Group) Volume() int {
+	if len(g.Speakers) == 0 {
+		return 0
+	}
+	total := 0
+	for _, speaker := range g.Speakers {
+		total += speaker.Volume.Percent
+	}
+	return int(math.Round(float64(total) / float64(len(g.Speakers))))
+}
+
+// ScaleVolume returns the group's speakers with their volumes scaled so that the group's volume is percent,
+// preserving their balance as Snapweb does:
+// turning down scales each speaker towards 0, and turning up scales each speaker towards 100, by the same proportion.
+func (g Group) ScaleVolume(percent int) []Speaker {
+	current := g.Volume()
+
+	speakers := make([]Speaker, len(g.Speakers))
+	copy(speakers, g.Speakers)
+	for i := range speakers {
+		v := float64(speakers[i].Volume.Percent)
+		switch {
+		case percent < current:
+			v -= v * float64(current-percent) / float64(current)
+		case percent > current:
+			v += (100 - v) * float64(percent-current) / float64(100-current)
+		}
+		speakers[i].Volume.Percent = int(math.Round(v))
+	}
+	return speakers
+}
+
+// SetGroupVolume sets a group's volume to percent, scaling each speaker's volume proportionally.
+// Mute is left as it is.
+func SetGroupVolume(ctx context.Context, client Client, groupID string, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("volume must be between 0 and 100, not %d", percent)
+	}
+
+	groups, err := client.Groups(ctx)
+	if err != nil {
+		return err
+	}
+	group, ok := groups[groupID]
+	if !ok {
+		return fmt.Errorf("could not find group %v", groupID)
+	}
+
+	return setSpeakerVolumes(ctx, client, group.Speakers, group.ScaleVolume(percent))
+}
+
+// setSpeakerVolumes sets the volume of each speaker in want that differs from the same speaker in have.
+func setSpeakerVolumes(ctx context.Context, client Client, have, want []Speaker) error {
+	for i, speaker := range want {
+		if speaker.Volume == have[i].Volume {
+			continue
+		}
+		if err := client.SetSpeakerVolume(ctx, speaker.ID, speaker.Volume); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2020 Ethel Morgan
+//
+// SPDX-License-Identifier: MIT
+
+package snapcast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScaleVolume(t *testing.T) {
+	group := func(volumes ...int) Group {
+		g := Group{ID: "group"}
+		for i, v := range volumes {
+			g.Speakers = append(g.Speakers, Speaker{
+				ID:     string(rune('a' + i)),
+				Volume: Volume{Percent: v, Muted: i == 0},
+			})
+		}
+		return g
+	}
+
+	tests := []struct {
+		name    string
+		group   Group
+		percent int
+		want    []int
+	}{
+		{"unchanged", group(40, 60), 50, []int{40, 60}},
+		{"down", group(40, 60), 25, []int{20, 30}},
+		{"up", group(40, 60), 75, []int{70, 80}},
+		{"to silence", group(40, 60), 0, []int{0, 0}},
+		{"to full", group(40, 60), 100, []int{100, 100}},
+		{"up from silence", group(0, 0), 30, []int{30, 30}},
+		{"down from full", group(100, 100), 30, []int{30, 30}},
+		{"no speakers", group(), 30, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			speakers := tt.group.ScaleVolume(tt.percent)
+
+			got := []int{}
+			for i, speaker := range speakers {
+				got = append(got, speaker.Volume.Percent)
+				if speaker.ID != tt.group.Speakers[i].ID || speaker.Volume.Muted != tt.group.Speakers[i].Volume.Muted {
+					t.Errorf("speaker %d is %+v, want only its volume changed from %+v", i, speaker, tt.group.Speakers[i])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScaleVolume(%d) = %v, want %v", tt.percent, got, tt.want)
+			}
+			if len(speakers) > 0 && (Group{Speakers: speakers}).Volume() != tt.percent {
+				t.Errorf("ScaleVolume(%d) has group volume %d", tt.percent, (Group{Speakers: speakers}).Volume())
+			}
+		})
+	}
+
+	// The original group must be left alone.
+	g := group(40, 60)
+	g.ScaleVolume(0)
+	if g.Speakers[0].Volume.Percent != 40 {
+		t.Errorf("ScaleVolume() changed the group's own speakers")
+	}
+}